@@ -16,8 +16,11 @@ import (
 	"github.com/yourname/company-superapp/internal/delivery/http"
 	"github.com/yourname/company-superapp/internal/delivery/websocket"
 	"github.com/yourname/company-superapp/internal/infrastructure/migrations"
+	"github.com/yourname/company-superapp/internal/pkg/authtoken"
 	"github.com/yourname/company-superapp/internal/pkg/encryption"
 	"github.com/yourname/company-superapp/internal/pkg/fcm"
+	"github.com/yourname/company-superapp/internal/pkg/mailer"
+	"github.com/yourname/company-superapp/internal/pkg/oidc"
 	"github.com/yourname/company-superapp/internal/pkg/s3"
 	"github.com/yourname/company-superapp/internal/repository/postgres"
 	"github.com/yourname/company-superapp/internal/service"
@@ -26,6 +29,10 @@ import (
 func main() {
 	// Загружаем конфигурацию
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		slog.Error("Некорректная конфигурация", "error", err)
+		os.Exit(1)
+	}
 
 	// Инициализируем структурированное логирование
 	initLogger(cfg.Server.Environment)
@@ -67,6 +74,20 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Выпуск и проверка JWT — общие для AuthService и AuthMiddleware
+	tokenManager, err := authtoken.NewManager(cfg.JWT)
+	if err != nil {
+		slog.Error("Не удалось загрузить ключи JWT", "error", err)
+		os.Exit(1)
+	}
+
+	// Почта: письма подтверждения email и сброса пароля
+	mailClient, err := mailer.New(cfg.Mail)
+	if err != nil {
+		slog.Error("Не удалось настроить отправку почты", "error", err)
+		os.Exit(1)
+	}
+
 	// Клиент MinIO
 	minioClient, err := s3.NewMinioClient()
 	if err != nil {
@@ -83,29 +104,46 @@ func main() {
 	userRepo := postgres.NewUserRepository(db)
 	chatRepo := postgres.NewChatRepository(db)
 	messageRepo := postgres.NewMessageRepository(db)
+	reactionRepo := postgres.NewReactionRepository(db)
+	attachmentRepo := postgres.NewAttachmentRepository(db)
 	taskRepo := postgres.NewTaskRepository(db)
 	salaryRepo := postgres.NewSalaryRepository(db)
 	taxiRequestRepo := postgres.NewTaxiRequestRepository(db)
 	pushTokenRepo := postgres.NewPushTokenRepository(db)
 	searchRepo := postgres.NewSearchRepository(db)
+	mfaRepo := postgres.NewMFARepository(db)
 
 	// Настройка Onion Architecture — Сервисы
-	authService := service.NewAuthService(userRepo, redisClient, cfg.JWT.Secret)
+	mfaService := service.NewMFAService(mfaRepo, userRepo, encryptionService, redisClient, cfg.MFA.Issuer, cfg.MFA.RequiredRoles)
+	loginGuard := service.NewLoginGuard(redisClient)
+	// Вход через корпоративный IdP включается переменной OIDC_ISSUER_URL
+	var sso *service.SSO
+	if cfg.OIDC.Enabled() {
+		sso = service.NewSSO(oidc.NewProvider(cfg.OIDC), postgres.NewIdentityRepository(db), cfg.OIDC.GroupsClaim, cfg.OIDC.RoleMapping, cfg.OIDC.DefaultRole)
+		slog.Info("Вход через OpenID Connect включён", "issuer", cfg.OIDC.IssuerURL)
+	}
+	authService := service.NewAuthService(userRepo, pushTokenRepo, redisClient, tokenManager, mailClient, mfaService, loginGuard, sso, cfg.Mail.AppURL, cfg.JWT.AccessExpiresIn, cfg.JWT.RefreshExpiresIn)
 	notificationService := service.NewNotificationService(pushTokenRepo, fcmClient)
-	chatService := service.NewChatService(chatRepo, messageRepo)
-	taskService := service.NewTaskService(taskRepo, messageRepo)
+	messagePushService := service.NewMessagePushService(chatRepo, userRepo, notificationService, redisClient)
+	chatService := service.NewChatService(chatRepo, messageRepo, userRepo, reactionRepo, attachmentRepo, messagePushService)
+	attachmentService := service.NewAttachmentService(attachmentRepo, chatRepo, minioClient)
+	presenceService := service.NewPresenceService(redisClient)
+	taskService := service.NewTaskService(taskRepo, messageRepo, chatRepo)
 	salaryService := service.NewSalaryService(salaryRepo, encryptionService)
 	taxiService := service.NewTaxiService(taxiRequestRepo, minioClient)
 	searchService := service.NewGlobalSearchService(searchRepo)
 	reportService := service.NewReportService(taskRepo)
 
 	// WebSocket Hub для real-time соединений
-	hub := websocket.NewHub(redisClient)
+	hub := websocket.NewHub(redisClient, chatService, presenceService)
+	messagePushService.SetConnectionChecker(hub)
+	authService.SetSessionNotifier(hub)
 	go hub.Run()
 
 	// Настройка HTTP обработчиков
-	authHandler := http.NewAuthHandler(authService)
-	chatHandler := http.NewChatHandler(chatService, hub)
+	authHandler := http.NewAuthHandler(authService, mfaService)
+	chatHandler := http.NewChatHandler(chatService, authService, attachmentService, hub)
+	userHandler := http.NewUserHandler(presenceService)
 	taskHandler := http.NewTaskHandler(taskService)
 	financeHandler := http.NewFinanceHandler(salaryService)
 	taxiHandler := http.NewTaxiHandler(taxiService)
@@ -124,13 +162,22 @@ func main() {
 	router.Use(http.TracingMiddleware())
 	router.Use(http.PrometheusMiddleware())
 
+	// Access token проверяются теми же ключами, которыми подписаны; токены отозванных сессий
+	// отклоняются до истечения их срока
+	http.ConfigureAuth(tokenManager, authService)
+
+	// Ограничение частоты запросов (token bucket в Redis), лимиты переопределяются через RATE_LIMIT_<ПОЛИТИКА>
+	http.ConfigureRateLimit(redisClient, cfg.RateLimit)
+
 	// Health и метрики (без авторизации)
 	healthHandler.RegisterRoutes(router)
+	authHandler.RegisterWellKnownRoutes(router)
 
 	// Маршруты API v1
-	apiV1 := router.Group("/api/v1")
+	apiV1 := router.Group("/api/v1", http.RateLimitMiddleware(http.APIRateLimit))
 	authHandler.RegisterRoutes(apiV1)
 	chatHandler.RegisterRoutes(apiV1)
+	userHandler.RegisterRoutes(apiV1)
 	taskHandler.RegisterRoutes(apiV1)
 	financeHandler.RegisterRoutes(apiV1)
 	taxiHandler.RegisterRoutes(apiV1)
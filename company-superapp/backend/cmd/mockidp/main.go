@@ -0,0 +1,34 @@
+// Mock IdP — минимальный OpenID Connect провайдер для локальной проверки входа через SSO,
+// см. пакет mockidp. Не запускайте его вне локального окружения
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/yourname/company-superapp/internal/pkg/mockidp"
+)
+
+func main() {
+	port := getEnv("MOCK_IDP_PORT", "8090")
+	clientID := getEnv("MOCK_IDP_CLIENT_ID", "superapp")
+	idp, err := mockidp.New(getEnv("MOCK_IDP_ISSUER", "http://localhost:"+port), clientID, os.Getenv("MOCK_IDP_CLIENT_SECRET"))
+	if err != nil {
+		slog.Error("Не удалось создать ключ подписи", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Запуск Mock IdP", "issuer", idp.Issuer(), "client_id", clientID)
+	if err := http.ListenAndServe(":"+port, idp.Handler()); err != nil {
+		slog.Error("Не удалось запустить Mock IdP", "error", err)
+		os.Exit(1)
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
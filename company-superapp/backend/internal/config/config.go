@@ -1,18 +1,35 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// DefaultJWTSecret — секрет по умолчанию для локальной разработки, в production запуск с ним запрещён
+const DefaultJWTSecret = "your-super-secret-key-change-in-production"
+
+var (
+	ErrDefaultJWTSecret = errors.New("JWT_SECRET is not set: the default secret is not allowed in production")
+	ErrOIDCClientID     = errors.New("OIDC_CLIENT_ID is required when OIDC_ISSUER_URL is set")
+	ErrLogMailDriver    = errors.New("MAIL_DRIVER=log is not allowed in production: emails would not be delivered")
+	ErrOIDCUnknownRole  = errors.New("OIDC_ROLE_MAPPING and OIDC_DEFAULT_ROLE may only use the roles user, manager and admin")
+)
+
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	JWT      JWTConfig
-	S3       S3Config
-	FCM      FCMConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Redis     RedisConfig
+	JWT       JWTConfig
+	S3        S3Config
+	FCM       FCMConfig
+	Mail      MailConfig
+	MFA       MFAConfig
+	RateLimit RateLimitConfig
+	OIDC      OIDCConfig
 }
 
 type ServerConfig struct {
@@ -41,9 +58,14 @@ type RedisConfig struct {
 }
 
 type JWTConfig struct {
-	Secret           string
-	AccessExpiresIn  time.Duration
-	RefreshExpiresIn time.Duration
+	// Algorithm — HS256 (подпись секретом Secret), RS256 или EdDSA (ключ из SigningKeyFile)
+	Algorithm      string
+	Secret         string
+	SigningKeyFile string
+	// VerificationKeyFiles — публичные ключи прежних подписей, токены с ними принимаются до истечения
+	VerificationKeyFiles []string
+	AccessExpiresIn      time.Duration
+	RefreshExpiresIn     time.Duration
 }
 
 type S3Config struct {
@@ -58,6 +80,59 @@ type FCMConfig struct {
 	ServerKey string
 }
 
+type MailConfig struct {
+	// Driver — smtp или log (письма пишутся в лог, а при заданном Dir — ещё и в .eml-файлы)
+	Driver       string
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	Dir          string
+	// AppURL — адрес клиентского приложения, на который ведут ссылки из писем
+	AppURL string
+}
+
+type RateLimitConfig struct {
+	Enabled bool
+	// Overrides — лимиты политик из переменных RATE_LIMIT_<ПОЛИТИКА>=<запросов>/<период>,
+	// например RATE_LIMIT_SEARCH=30/1m; ключ — имя политики в нижнем регистре
+	Overrides map[string]RateLimitRule
+}
+
+type RateLimitRule struct {
+	Requests int
+	Period   time.Duration
+}
+
+type MFAConfig struct {
+	// Issuer — название сервиса в приложении-аутентификаторе
+	Issuer string
+	// RequiredRoles — роли, которым нельзя войти без второго фактора
+	RequiredRoles []string
+}
+
+type OIDCConfig struct {
+	// IssuerURL — адрес корпоративного IdP; вход через SSO включён, только если он задан
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL — страница клиента, куда IdP возвращает code; клиент передаёт его в /auth/sso/callback
+	RedirectURL string
+	Scopes      []string
+	// GroupsClaim — claim id_token со списком групп пользователя
+	GroupsClaim string
+	// RoleMapping — роль по группе IdP из OIDC_ROLE_MAPPING=<группа>=<роль>;<группа>=<роль>
+	RoleMapping map[string]string
+	// DefaultRole — роль пользователя, ни одна группа которого не указана в RoleMapping
+	DefaultRole string
+}
+
+// Enabled сообщает, настроен ли вход через IdP
+func (c OIDCConfig) Enabled() bool {
+	return c.IssuerURL != ""
+}
+
 func Load() *Config {
 	return &Config{
 		Server: ServerConfig{
@@ -83,9 +158,12 @@ func Load() *Config {
 			DB:       getIntEnv("REDIS_DB", 0),
 		},
 		JWT: JWTConfig{
-			Secret:           getEnv("JWT_SECRET", "your-super-secret-key-change-in-production"),
-			AccessExpiresIn:  getDurationEnv("JWT_ACCESS_EXPIRES", 15*time.Minute),
-			RefreshExpiresIn: getDurationEnv("JWT_REFRESH_EXPIRES", 7*24*time.Hour),
+			Algorithm:            getEnv("JWT_ALGORITHM", "HS256"),
+			Secret:               getEnv("JWT_SECRET", DefaultJWTSecret),
+			SigningKeyFile:       getEnv("JWT_SIGNING_KEY_FILE", ""),
+			VerificationKeyFiles: getListEnv("JWT_VERIFICATION_KEY_FILES", nil),
+			AccessExpiresIn:      getDurationEnv("JWT_ACCESS_EXPIRES", 15*time.Minute),
+			RefreshExpiresIn:     getDurationEnv("JWT_REFRESH_EXPIRES", 7*24*time.Hour),
 		},
 		S3: S3Config{
 			Endpoint:  getEnv("S3_ENDPOINT", "localhost:9000"),
@@ -97,6 +175,34 @@ func Load() *Config {
 		FCM: FCMConfig{
 			ServerKey: getEnv("FCM_SERVER_KEY", ""),
 		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "log"),
+			From:         getEnv("MAIL_FROM", "Company SuperApp <no-reply@superapp.local>"),
+			SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+			SMTPPort:     getIntEnv("SMTP_PORT", 1025),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			Dir:          getEnv("MAIL_DIR", ""),
+			AppURL:       getEnv("APP_URL", "http://localhost:8081"),
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:   getBoolEnv("RATE_LIMIT_ENABLED", true),
+			Overrides: getRateLimitOverrides("RATE_LIMIT_"),
+		},
+		MFA: MFAConfig{
+			Issuer:        getEnv("MFA_ISSUER", "Company SuperApp"),
+			RequiredRoles: getListEnv("MFA_REQUIRED_ROLES", []string{"admin", "manager"}),
+		},
+		OIDC: OIDCConfig{
+			IssuerURL:    strings.TrimRight(getEnv("OIDC_ISSUER_URL", ""), "/"),
+			ClientID:     getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8081/sso/callback"),
+			Scopes:       getListEnv("OIDC_SCOPES", []string{"openid", "email", "profile"}),
+			GroupsClaim:  getEnv("OIDC_GROUPS_CLAIM", "groups"),
+			RoleMapping:  getRoleMappingEnv("OIDC_ROLE_MAPPING"),
+			DefaultRole:  getEnv("OIDC_DEFAULT_ROLE", "user"),
+		},
 	}
 }
 
@@ -134,6 +240,92 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
+// getListEnv читает список значений через запятую, пропуская пустые
+func getListEnv(key string, defaultValue []string) []string {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getRateLimitOverrides собирает переменные вида <prefix><ПОЛИТИКА>=<запросов>/<период>;
+// записи в неверном формате пропускаются, и для политики действует лимит по умолчанию
+func getRateLimitOverrides(prefix string) map[string]RateLimitRule {
+	overrides := make(map[string]RateLimitRule)
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		name, ok := strings.CutPrefix(key, prefix)
+		if !ok || name == "ENABLED" {
+			continue
+		}
+		requests, period, ok := strings.Cut(value, "/")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(requests)
+		if err != nil || n <= 0 {
+			continue
+		}
+		d, err := time.ParseDuration(period)
+		if err != nil || d <= 0 {
+			continue
+		}
+		overrides[strings.ToLower(name)] = RateLimitRule{Requests: n, Period: d}
+	}
+	return overrides
+}
+
+// getRoleMappingEnv читает пары <группа>=<роль> через точку с запятой. Роль отделяется последним «=»,
+// поэтому группы в виде LDAP DN (cn=admins,ou=groups) указываются как есть
+func getRoleMappingEnv(key string) map[string]string {
+	mapping := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ";") {
+		i := strings.LastIndex(pair, "=")
+		if i < 0 {
+			continue
+		}
+		group, role := strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+		if group != "" && role != "" {
+			mapping[group] = role
+		}
+	}
+	return mapping
+}
+
+// knownRoles — роли, которые IdP может назначить пользователю
+var knownRoles = map[string]bool{"user": true, "manager": true, "admin": true}
+
+// Validate проверяет настройки, с которыми нельзя запускать сервер
+func (c *Config) Validate() error {
+	if c.Server.Environment == "production" && c.JWT.Algorithm == "HS256" && c.JWT.Secret == DefaultJWTSecret {
+		return ErrDefaultJWTSecret
+	}
+	if c.Server.Environment == "production" && c.Mail.Driver == "log" {
+		return ErrLogMailDriver
+	}
+	if c.OIDC.Enabled() && c.OIDC.ClientID == "" {
+		return ErrOIDCClientID
+	}
+	if c.OIDC.Enabled() {
+		if !knownRoles[c.OIDC.DefaultRole] {
+			return fmt.Errorf("%w: %q", ErrOIDCUnknownRole, c.OIDC.DefaultRole)
+		}
+		for group, role := range c.OIDC.RoleMapping {
+			if !knownRoles[role] {
+				return fmt.Errorf("%w: %q for group %q", ErrOIDCUnknownRole, role, group)
+			}
+		}
+	}
+	return nil
+}
+
 // DSN возвращает строку подключения к PostgreSQL
 func (c *DatabaseConfig) DSN() string {
 	return "host=" + c.Host +
@@ -1,29 +1,71 @@
 package http
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourname/company-superapp/internal/pkg/metrics"
 	"github.com/yourname/company-superapp/internal/service"
 )
 
+// authEmailRateLimit ограничивает запросы, которые отправляют письма, — по IP, до авторизации
+var authEmailRateLimit = RateLimitPolicy{Name: "auth_email", Requests: 20, Period: time.Hour}
+
 type AuthHandler struct {
-	service *service.AuthService
+	service    *service.AuthService
+	mfaService *service.MFAService
 }
 
-func NewAuthHandler(service *service.AuthService) *AuthHandler {
-	return &AuthHandler{service: service}
+func NewAuthHandler(service *service.AuthService, mfaService *service.MFAService) *AuthHandler {
+	return &AuthHandler{service: service, mfaService: mfaService}
 }
 
 func (h *AuthHandler) RegisterRoutes(router *gin.RouterGroup) {
 	auth := router.Group("/auth")
 	{
-		auth.POST("/register", h.register)
+		auth.POST("/register", RateLimitMiddleware(authEmailRateLimit), h.register)
 		auth.POST("/login", h.login)
-		// auth.POST("/refresh", h.refresh) // Заглушка для логики обновления токена
+		auth.POST("/refresh", h.refresh)
+		auth.POST("/verify-email", h.verifyEmail)
+		auth.POST("/resend-verification", RateLimitMiddleware(authEmailRateLimit), h.resendVerification)
+		auth.POST("/forgot-password", RateLimitMiddleware(authEmailRateLimit), h.forgotPassword)
+		auth.POST("/reset-password", h.resetPassword)
+		auth.POST("/logout", AuthMiddleware(), h.logout)
+		auth.GET("/sessions", AuthMiddleware(), h.listSessions)
+		auth.DELETE("/sessions/:id", AuthMiddleware(), h.revokeSession)
+		auth.DELETE("/users/:id/lockout", AuthMiddleware(), RBACMiddleware("admin"), h.unlockLogin)
+
+		// Вход через корпоративный IdP (OpenID Connect)
+		auth.POST("/sso/start", h.startSSO)
+		auth.POST("/sso/callback", h.completeSSO)
+
+		// Второй шаг входа: по mfa_token из ответа login, без access token
+		auth.POST("/mfa/enroll", h.enrollMFA)
+		auth.POST("/mfa/verify", h.verifyMFA)
+
+		mfa := auth.Group("/mfa", AuthMiddleware())
+		mfa.GET("", h.mfaStatus)
+		mfa.POST("/setup", h.setupMFA)
+		mfa.POST("/enable", h.enableMFA)
+		mfa.POST("/recovery-codes", h.regenerateRecoveryCodes)
+		mfa.DELETE("", h.disableMFA)
 	}
 }
 
+// RegisterWellKnownRoutes публикует ключи проверки подписи по стандартному пути, вне /api/v1
+func (h *AuthHandler) RegisterWellKnownRoutes(router *gin.Engine) {
+	router.GET("/.well-known/jwks.json", h.jwks)
+}
+
+func (h *AuthHandler) jwks(c *gin.Context) {
+	// Клиенты кэшируют набор ключей; новый ключ публикуется заранее через JWT_VERIFICATION_KEY_FILES
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.service.JWKS())
+}
+
 func (h *AuthHandler) register(c *gin.Context) {
 	var input service.RegisterInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -47,12 +89,409 @@ func (h *AuthHandler) login(c *gin.Context) {
 		return
 	}
 
-	tokens, err := h.service.Login(c.Request.Context(), input)
+	tokens, challenge, err := h.service.Login(c.Request.Context(), input, sessionClient(c))
+	var retryErr *service.RetryAfterError
+	if errors.As(err, &retryErr) {
+		respondRetryAfter(c, "login", retryErr)
+		return
+	}
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		// В реальном приложении нужно проверять тип ошибки для возврата 401 или 500
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) refresh(c *gin.Context) {
+	var input service.RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.service.Refresh(c.Request.Context(), input.RefreshToken, sessionClient(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidRefresh),
+			errors.Is(err, service.ErrRefreshReused),
+			errors.Is(err, service.ErrMFAEnrollmentRequired):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) verifyEmail(c *gin.Context) {
+	var input service.VerifyEmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.service.VerifyEmail(c.Request.Context(), input.Token)
+	if errors.Is(err, service.ErrInvalidEmailToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// resendVerification и forgotPassword всегда отвечают 202, чтобы по ответу нельзя было
+// узнать, зарегистрирован ли адрес
+func (h *AuthHandler) resendVerification(c *gin.Context) {
+	var input service.EmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.ResendVerification(c.Request.Context(), input.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send verification email"})
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+func (h *AuthHandler) forgotPassword(c *gin.Context) {
+	var input service.EmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.ForgotPassword(c.Request.Context(), input.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send password reset email"})
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+func (h *AuthHandler) resetPassword(c *gin.Context) {
+	var input service.ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.service.ResetPassword(c.Request.Context(), input)
+	if errors.Is(err, service.ErrInvalidEmailToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// logout завершает текущую сессию: refresh token перестаёт работать, access token отклоняется
+func (h *AuthHandler) logout(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	err := h.service.Logout(c.Request.Context(), userID, c.GetString("session_id"))
+	if errors.Is(err, service.ErrNoSession) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log out"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) listSessions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.service.ListSessions(c.Request.Context(), userID, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// revokeSession завершает сессию на другом устройстве и удаляет его push-токен
+func (h *AuthHandler) revokeSession(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+
+	err = h.service.RevokeSession(c.Request.Context(), userID, sessionID)
+	if errors.Is(err, service.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// unlockLogin снимает блокировку входа после серии неверных паролей (только администратор)
+func (h *AuthHandler) unlockLogin(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	err = h.service.UnlockLogin(c.Request.Context(), userID)
+	if errors.Is(err, service.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock login"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// startSSO возвращает адрес страницы входа IdP; клиент открывает его в браузере
+func (h *AuthHandler) startSSO(c *gin.Context) {
+	var input service.SSOStartInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	authorization, err := h.service.StartSSO(c.Request.Context(), input)
+	if err != nil {
+		respondSSOError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, authorization)
+}
+
+// completeSSO принимает code и state, с которыми IdP вернул пользователя, и отвечает как login
+func (h *AuthHandler) completeSSO(c *gin.Context) {
+	var input service.SSOCallbackInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, challenge, err := h.service.CompleteSSO(c.Request.Context(), input, sessionClient(c))
+	if err != nil {
+		respondSSOError(c, err)
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
 
 	c.JSON(http.StatusOK, tokens)
 }
+
+func (h *AuthHandler) enrollMFA(c *gin.Context) {
+	var input service.MFATokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	setup, err := h.service.EnrollMFA(c.Request.Context(), input.MFAToken)
+	if err != nil {
+		respondMFAError(c, err, "failed to set up two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+func (h *AuthHandler) verifyMFA(c *gin.Context) {
+	var input service.MFAVerifyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.service.VerifyMFA(c.Request.Context(), input, sessionClient(c))
+	if err != nil {
+		respondMFAError(c, err, "failed to verify two-factor authentication code")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *AuthHandler) mfaStatus(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	status, err := h.mfaService.Status(c.Request.Context(), userID, c.GetString("user_role"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get two-factor authentication status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// setupMFA выдаёт новый секрет; MFA включается только после enableMFA
+func (h *AuthHandler) setupMFA(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	setup, err := h.mfaService.Setup(c.Request.Context(), userID)
+	if err != nil {
+		respondMFAError(c, err, "failed to set up two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+func (h *AuthHandler) enableMFA(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var input service.MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.mfaService.Enable(c.Request.Context(), userID, input.Code)
+	if err != nil {
+		respondMFAError(c, err, "failed to enable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (h *AuthHandler) regenerateRecoveryCodes(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var input service.MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(c.Request.Context(), userID, input.Code)
+	if err != nil {
+		respondMFAError(c, err, "failed to regenerate recovery codes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (h *AuthHandler) disableMFA(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var input service.MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.mfaService.Disable(c.Request.Context(), userID, input.Code); err != nil {
+		respondMFAError(c, err, "failed to disable two-factor authentication")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func respondMFAError(c *gin.Context, err error, fallback string) {
+	var retryErr *service.RetryAfterError
+	if errors.As(err, &retryErr) {
+		respondRetryAfter(c, "mfa", retryErr)
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrInvalidMFAChallenge),
+		errors.Is(err, service.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMFARequiredByRole):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMFAAlreadyEnabled),
+		errors.Is(err, service.ErrMFANotEnabled),
+		errors.Is(err, service.ErrMFANotSetUp):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+func respondSSOError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrSSONotConfigured):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidSSOState),
+		errors.Is(err, service.ErrSSOFailed):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSSOEmailNotVerified):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSSOUnavailable):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign in with identity provider"})
+	}
+}
+
+// respondRetryAfter отвечает 429 с заголовком Retry-After в целых секундах (с округлением вверх)
+func respondRetryAfter(c *gin.Context, policy string, err *service.RetryAfterError) {
+	metrics.RateLimitRejectionsTotal.WithLabelValues(policy).Inc()
+	seconds := setRetryAfter(c, err.RetryAfter)
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "retry_after": seconds})
+}
+
+func sessionClient(c *gin.Context) service.SessionClient {
+	return service.SessionClient{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
@@ -1,42 +1,74 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	gorillaws "github.com/gorilla/websocket"
 	"github.com/yourname/company-superapp/internal/delivery/websocket"
+	"github.com/yourname/company-superapp/internal/domain"
 	"github.com/yourname/company-superapp/internal/service"
 )
 
 type ChatHandler struct {
-	service *service.ChatService
-	hub     *websocket.Hub
+	service           *service.ChatService
+	authService       *service.AuthService
+	attachmentService *service.AttachmentService
+	hub               *websocket.Hub
 }
 
-func NewChatHandler(service *service.ChatService, hub *websocket.Hub) *ChatHandler {
+func NewChatHandler(service *service.ChatService, authService *service.AuthService, attachmentService *service.AttachmentService, hub *websocket.Hub) *ChatHandler {
 	return &ChatHandler{
-		service: service,
-		hub:     hub,
+		service:           service,
+		authService:       authService,
+		attachmentService: attachmentService,
+		hub:               hub,
 	}
 }
 
 func (h *ChatHandler) RegisterRoutes(router *gin.RouterGroup) {
 	chats := router.Group("/chats")
+	chats.Use(AuthMiddleware())
 	{
 		chats.GET("", h.getChats)
+		chats.GET("/sync", h.syncMessages)
+		chats.POST("", h.createChat)
+		chats.PATCH("/:id", h.renameChat)
 		chats.GET("/:id/messages", h.getMessages)
+		chats.PATCH("/:id/messages/:messageId", h.editMessage)
+		chats.DELETE("/:id/messages/:messageId", h.deleteMessage)
+		chats.GET("/:id/messages/:messageId/history", h.getMessageHistory)
+		chats.GET("/:id/messages/:messageId/thread", h.getThread)
+		chats.POST("/:id/messages/:messageId/reactions", h.addReaction)
+		chats.DELETE("/:id/messages/:messageId/reactions/:emoji", h.removeReaction)
+		chats.POST("/:id/read", h.markRead)
+		chats.PUT("/:id/mute", h.muteChat)
+		chats.DELETE("/:id/mute", h.unmuteChat)
+		chats.POST("/:id/attachments", h.createAttachment)
+		chats.POST("/:id/attachments/:attachmentId/confirm", h.confirmAttachment)
+		chats.GET("/:id/attachments/:attachmentId", h.downloadAttachment)
+		chats.GET("/:id/members", h.getMembers)
+		chats.POST("/:id/members", h.addMember)
+		chats.DELETE("/:id/members/:userId", h.removeMember)
+		chats.POST("/:id/leave", h.leaveChat)
 	}
+	router.GET("/mentions", AuthMiddleware(), h.getMentions)
 	ws := router.Group("/ws")
 	{
+		ws.POST("/ticket", AuthMiddleware(), h.issueWSTicket)
 		ws.GET("/connect", h.handleWebSocket)
 	}
 }
 
 func (h *ChatHandler) getChats(c *gin.Context) {
-	// For now, we'll use a placeholder user ID. In a real app, this would come from the JWT.
-	userID, _ := uuid.NewRandom() 
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
 	chats, err := h.service.GetUserChats(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get chats"})
@@ -45,42 +77,665 @@ func (h *ChatHandler) getChats(c *gin.Context) {
 	c.JSON(http.StatusOK, chats)
 }
 
+func (h *ChatHandler) createChat(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var input service.CreateChatInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.service.CreateChat(c.Request.Context(), userID, input)
+	if err != nil {
+		writeChatError(c, err, "could not create chat")
+		return
+	}
+
+	if !result.Created {
+		// Личный чат с этим пользователем уже есть
+		c.JSON(http.StatusOK, result.Chat)
+		return
+	}
+	h.hub.NotifyChatCreated(result.Chat, result.MemberIDs)
+	c.JSON(http.StatusCreated, result.Chat)
+}
+
+func (h *ChatHandler) renameChat(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, ok := parseChatID(c)
+	if !ok {
+		return
+	}
+
+	var input service.RenameChatInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	chat, err := h.service.RenameChat(c.Request.Context(), userID, chatID, input.Name)
+	if err != nil {
+		writeChatError(c, err, "could not rename chat")
+		return
+	}
+
+	h.hub.NotifyChatUpdated(chat)
+	c.JSON(http.StatusOK, chat)
+}
+
 func (h *ChatHandler) getMessages(c *gin.Context) {
-	chatID, err := uuid.Parse(c.Param("id"))
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, ok := parseChatID(c)
+	if !ok {
+		return
+	}
+
+	cursor, ok := parseMessageCursor(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.service.GetChatMessages(c.Request.Context(), chatID, userID, cursor)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat id"})
+		writeChatError(c, err, "could not get messages")
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// getMentions отдаёт сообщения с упоминанием текущего пользователя
+// GET /api/v1/mentions?before_id=123&limit=50
+func (h *ChatHandler) getMentions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
 		return
 	}
-	// Placeholder user ID
-	userID, _ := uuid.NewRandom()
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	beforeID, err := parseOptionalInt64(c, "before_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid before_id"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
 
-	messages, err := h.service.GetChatMessages(c.Request.Context(), chatID, userID, page, pageSize)
+	page, err := h.service.GetMentions(c.Request.Context(), userID, beforeID, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get messages"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get mentions"})
 		return
 	}
-	c.JSON(http.StatusOK, messages)
+	c.JSON(http.StatusOK, page)
 }
 
-func (h *ChatHandler) handleWebSocket(c *gin.Context) {
-	// In a real app, userID would come from JWT middleware
-	userIDStr := c.Query("user_id")
-	chatIDStr := c.Query("chat_id")
+// syncMessages отдаёт сообщения всех чатов пользователя после since_id
+// GET /api/v1/chats/sync?since_id=123&limit=500
+func (h *ChatHandler) syncMessages(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sinceID, err := strconv.ParseInt(c.DefaultQuery("since_id", "0"), 10, 64)
+	if err != nil || sinceID < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since_id"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	result, err := h.service.SyncMessages(c.Request.Context(), userID, sinceID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not sync messages"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *ChatHandler) editMessage(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, messageID, ok := parseMessagePath(c)
+	if !ok {
+		return
+	}
+
+	var input service.EditMessageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	msg, err := h.service.EditMessage(c.Request.Context(), userID, chatID, messageID, input.Content)
+	if err != nil {
+		writeChatError(c, err, "could not edit message")
+		return
+	}
+
+	h.hub.NotifyMessageEdited(msg)
+	c.JSON(http.StatusOK, msg)
+}
+
+// deleteMessage удаляет сообщение; ?hard=true — безвозвратное удаление модератором
+func (h *ChatHandler) deleteMessage(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, messageID, ok := parseMessagePath(c)
+	if !ok {
+		return
+	}
+	hard := c.Query("hard") == "true"
+
+	msg, err := h.service.DeleteMessage(c.Request.Context(), userID, c.GetString("user_role"), chatID, messageID, hard)
+	if err != nil {
+		writeChatError(c, err, "could not delete message")
+		return
+	}
+
+	h.hub.NotifyMessageDeleted(msg, hard)
+	c.JSON(http.StatusOK, gin.H{"message": "message deleted"})
+}
+
+func (h *ChatHandler) getMessageHistory(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, messageID, ok := parseMessagePath(c)
+	if !ok {
+		return
+	}
+
+	edits, err := h.service.GetMessageHistory(c.Request.Context(), userID, c.GetString("user_role"), chatID, messageID)
+	if err != nil {
+		writeChatError(c, err, "could not get message history")
+		return
+	}
+	c.JSON(http.StatusOK, edits)
+}
+
+// getThread возвращает корень треда и страницу ответов: ?before_id= | ?after_id=, &limit=
+func (h *ChatHandler) getThread(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, messageID, ok := parseMessagePath(c)
+	if !ok {
+		return
+	}
+	cursor, ok := parseMessageCursor(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.service.GetThread(c.Request.Context(), userID, chatID, messageID, cursor)
+	if err != nil {
+		writeChatError(c, err, "could not get thread")
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *ChatHandler) addReaction(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, messageID, ok := parseMessagePath(c)
+	if !ok {
+		return
+	}
+
+	var input service.ReactionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reaction, added, err := h.service.AddReaction(c.Request.Context(), userID, chatID, messageID, input.Emoji)
+	if err != nil {
+		writeChatError(c, err, "could not add reaction")
+		return
+	}
+	if added {
+		h.hub.NotifyReaction(reaction, true)
+		c.JSON(http.StatusCreated, reaction)
+		return
+	}
+	c.JSON(http.StatusOK, reaction)
+}
+
+func (h *ChatHandler) removeReaction(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, messageID, ok := parseMessagePath(c)
+	if !ok {
+		return
+	}
+
+	reaction, removed, err := h.service.RemoveReaction(c.Request.Context(), userID, chatID, messageID, c.Param("emoji"))
+	if err != nil {
+		writeChatError(c, err, "could not remove reaction")
+		return
+	}
+	if removed {
+		h.hub.NotifyReaction(reaction, false)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "reaction removed"})
+}
+
+// createAttachment регистрирует вложение и возвращает presigned URL для загрузки в MinIO
+func (h *ChatHandler) createAttachment(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, ok := parseChatID(c)
+	if !ok {
+		return
+	}
+
+	var input service.CreateAttachmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	upload, err := h.attachmentService.CreateUpload(c.Request.Context(), userID, chatID, input)
+	if err != nil {
+		writeChatError(c, err, "could not create attachment")
+		return
+	}
+	c.JSON(http.StatusCreated, upload)
+}
+
+// confirmAttachment проверяет загруженный файл; после этого его можно отправить в сообщении
+func (h *ChatHandler) confirmAttachment(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, attachmentID, ok := parseAttachmentPath(c)
+	if !ok {
+		return
+	}
+
+	attachment, err := h.attachmentService.ConfirmUpload(c.Request.Context(), userID, chatID, attachmentID)
+	if err != nil {
+		writeChatError(c, err, "could not confirm attachment")
+		return
+	}
+	c.JSON(http.StatusOK, attachment)
+}
+
+// downloadAttachment возвращает presigned URL на скачивание файла
+func (h *ChatHandler) downloadAttachment(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, attachmentID, ok := parseAttachmentPath(c)
+	if !ok {
+		return
+	}
+
+	url, err := h.attachmentService.GetDownloadURL(c.Request.Context(), userID, chatID, attachmentID)
+	if err != nil {
+		writeChatError(c, err, "could not get download url")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": url})
+}
+
+// markRead отмечает сообщения чата прочитанными до message_id включительно
+func (h *ChatHandler) markRead(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, ok := parseChatID(c)
+	if !ok {
+		return
+	}
+
+	var input service.MarkReadInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	receipt, advanced, err := h.service.MarkRead(c.Request.Context(), userID, chatID, input.MessageID)
+	if err != nil {
+		writeChatError(c, err, "could not mark chat as read")
+		return
+	}
+	if advanced {
+		h.hub.NotifyRead(receipt)
+	}
+	c.JSON(http.StatusOK, receipt)
+}
+
+// muteChat отключает уведомления чата; тело запроса необязательно
+func (h *ChatHandler) muteChat(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, ok := parseChatID(c)
+	if !ok {
+		return
+	}
+
+	var input service.MuteChatInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	mute, err := h.service.MuteChat(c.Request.Context(), userID, chatID, input.Until)
+	if err != nil {
+		writeChatError(c, err, "could not mute chat")
+		return
+	}
+	c.JSON(http.StatusOK, mute)
+}
+
+func (h *ChatHandler) unmuteChat(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, ok := parseChatID(c)
+	if !ok {
+		return
+	}
+
+	mute, err := h.service.UnmuteChat(c.Request.Context(), userID, chatID)
+	if err != nil {
+		writeChatError(c, err, "could not unmute chat")
+		return
+	}
+	c.JSON(http.StatusOK, mute)
+}
+
+func (h *ChatHandler) getMembers(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, ok := parseChatID(c)
+	if !ok {
+		return
+	}
+
+	members, err := h.service.GetMembers(c.Request.Context(), userID, chatID)
+	if err != nil {
+		writeChatError(c, err, "could not get members")
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+type AddMemberRequest struct {
+	UserID uuid.UUID `json:"user_id" binding:"required"`
+}
+
+func (h *ChatHandler) addMember(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, ok := parseChatID(c)
+	if !ok {
+		return
+	}
+
+	var req AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.AddMember(c.Request.Context(), userID, chatID, req.UserID); err != nil {
+		writeChatError(c, err, "could not add member")
+		return
+	}
+
+	h.hub.NotifyMemberAdded(chatID, req.UserID)
+	c.JSON(http.StatusCreated, gin.H{"message": "member added"})
+}
+
+func (h *ChatHandler) removeMember(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, ok := parseChatID(c)
+	if !ok {
+		return
+	}
+	memberID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	if err := h.service.RemoveMember(c.Request.Context(), userID, chatID, memberID); err != nil {
+		writeChatError(c, err, "could not remove member")
+		return
+	}
+
+	h.hub.NotifyMemberRemoved(chatID, memberID)
+	c.JSON(http.StatusOK, gin.H{"message": "member removed"})
+}
+
+func (h *ChatHandler) leaveChat(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	chatID, ok := parseChatID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.LeaveChat(c.Request.Context(), userID, chatID); err != nil {
+		writeChatError(c, err, "could not leave chat")
+		return
+	}
+
+	h.hub.NotifyMemberRemoved(chatID, userID)
+	c.JSON(http.StatusOK, gin.H{"message": "left chat"})
+}
+
+func parseChatID(c *gin.Context) (uuid.UUID, bool) {
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat id"})
+		return uuid.Nil, false
+	}
+	return chatID, true
+}
+
+func parseMessagePath(c *gin.Context) (uuid.UUID, int64, bool) {
+	chatID, ok := parseChatID(c)
+	if !ok {
+		return uuid.Nil, 0, false
+	}
+	messageID, err := strconv.ParseInt(c.Param("messageId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return uuid.Nil, 0, false
+	}
+	return chatID, messageID, true
+}
 
-	userID, err := uuid.Parse(userIDStr)
+func parseAttachmentPath(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	chatID, ok := parseChatID(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	attachmentID, err := uuid.Parse(c.Param("attachmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attachment id"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return chatID, attachmentID, true
+}
+
+// parseMessageCursor читает keyset-курсор из ?before_id=, ?after_id= и ?limit=
+func parseMessageCursor(c *gin.Context) (domain.MessageCursor, bool) {
+	var cursor domain.MessageCursor
+	var err error
+	if cursor.BeforeID, err = parseOptionalInt64(c, "before_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid before_id"})
+		return cursor, false
+	}
+	if cursor.AfterID, err = parseOptionalInt64(c, "after_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after_id"})
+		return cursor, false
+	}
+	cursor.Limit, _ = strconv.Atoi(c.Query("limit"))
+	return cursor, true
+}
+
+func parseOptionalInt64(c *gin.Context, name string) (*int64, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+		return nil, err
+	}
+	return &value, nil
+}
+
+// writeChatError переводит ошибки ChatService в HTTP-статусы
+func writeChatError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrChatNotFound),
+		errors.Is(err, service.ErrMessageNotFound),
+		errors.Is(err, service.ErrAttachmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotChatMember),
+		errors.Is(err, service.ErrNotChatOwner),
+		errors.Is(err, service.ErrNotMessageAuthor),
+		errors.Is(err, service.ErrModeratorOnly):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMessageDeleted):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAlreadyChatMember),
+		errors.Is(err, service.ErrAttachmentNotUploaded),
+		errors.Is(err, domain.ErrAttachmentsUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAttachmentTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAttachmentType):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAttachmentMismatch):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrStorageUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotGroupChat),
+		errors.Is(err, service.ErrInvalidChatMembers),
+		errors.Is(err, service.ErrChatNameRequired),
+		errors.Is(err, service.ErrEmptyMessage),
+		errors.Is(err, service.ErrInvalidCursor),
+		errors.Is(err, service.ErrInvalidReaction),
+		errors.Is(err, service.ErrInvalidAttachment),
+		errors.Is(err, service.ErrTooManyAttachments),
+		errors.Is(err, service.ErrInvalidMuteUntil):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// wsAccessTokenProtocol — имя подпротокола, после которого клиент передаёт access token:
+// new WebSocket(url, ["access_token", token])
+const wsAccessTokenProtocol = "access_token"
+
+// issueWSTicket выдаёт одноразовый тикет для подключения к WebSocket
+func (h *ChatHandler) issueWSTicket(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
 		return
 	}
+	expiresAt, _ := c.Get("token_expires_at")
+	tokenExpiresAt, _ := expiresAt.(time.Time)
 
-	chatID, err := uuid.Parse(chatIDStr)
+	ticket, err := h.authService.IssueWSTicket(c.Request.Context(), userID, c.GetString("user_role"), c.GetString("session_id"), tokenExpiresAt)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat_id"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue ticket"})
 		return
 	}
 
-	websocket.ServeWs(h.hub, c.Writer, c.Request, userID, chatID)
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket.Ticket})
+}
+
+func (h *ChatHandler) handleWebSocket(c *gin.Context) {
+	auth, err := h.authenticateWebSocket(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	websocket.ServeWs(h.hub, c.Writer, c.Request, auth.userID, auth.sessionID, auth.expiresAt, auth.responseHeader)
+}
+
+// wsAuth — пользователь и сессия, от имени которых открывается WebSocket
+type wsAuth struct {
+	userID    uuid.UUID
+	sessionID string
+	expiresAt time.Time
+	// responseHeader подтверждает выбранный клиентом Sec-WebSocket-Protocol
+	responseHeader http.Header
+}
+
+// authenticateWebSocket определяет пользователя по одноразовому тикету (?ticket=)
+// или по access token, переданному в Sec-WebSocket-Protocol
+func (h *ChatHandler) authenticateWebSocket(c *gin.Context) (*wsAuth, error) {
+	if ticket := c.Query("ticket"); ticket != "" {
+		wsTicket, err := h.authService.RedeemWSTicket(c.Request.Context(), ticket)
+		if err != nil {
+			return nil, errors.New("invalid or expired ticket")
+		}
+		return &wsAuth{userID: wsTicket.UserID, sessionID: wsTicket.SessionID, expiresAt: wsTicket.ExpiresAt}, nil
+	}
+
+	protocols := gorillaws.Subprotocols(c.Request)
+	if len(protocols) != 2 || protocols[0] != wsAccessTokenProtocol {
+		return nil, errors.New("authentication required")
+	}
+
+	claims, err := authenticate(c.Request.Context(), protocols[1])
+	if err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil, errors.New("invalid user id")
+	}
+
+	// Браузер закроет соединение, если сервер не подтвердит один из предложенных подпротоколов
+	responseHeader := http.Header{}
+	responseHeader.Set("Sec-WebSocket-Protocol", wsAccessTokenProtocol)
+	return &wsAuth{userID: userID, sessionID: claims.SessionID, expiresAt: claims.ExpiresAt, responseHeader: responseHeader}, nil
 }
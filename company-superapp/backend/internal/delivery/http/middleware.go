@@ -1,12 +1,16 @@
 package http
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 func AuthMiddleware() gin.HandlerFunc {
@@ -25,47 +29,134 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		tokenString := parts[1]
-		jwtSecret := os.Getenv("JWT_SECRET")
-
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(jwtSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		claims, err := authenticate(c.Request.Context(), parts[1])
+		if errors.Is(err, errSessionCheckFailed) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token claims"})
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
 
-		// Extract user_id from "sub" claim
-		userID, ok := claims["sub"].(string)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "user_id not found in token"})
-			c.Abort()
-			return
-		}
+		c.Set("user_id", claims.UserID)
+		c.Set("user_role", claims.Role)
+		c.Set("session_id", claims.SessionID)
+		c.Set("token_expires_at", claims.ExpiresAt)
+		c.Next()
+	}
+}
 
-		// Extract role from claims
-		role, _ := claims["role"].(string)
-		if role == "" {
-			role = "user" // Default role
-		}
+// currentUserID returns the ID of the user authenticated by AuthMiddleware.
+// On failure it writes a 401 response and returns false.
+func currentUserID(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
 
-		c.Set("user_id", userID)
-		c.Set("user_role", role)
-		c.Next()
+// accessClaims holds the data extracted from a verified access token
+type accessClaims struct {
+	UserID string
+	Role   string
+	// SessionID is the login session (sid claim); empty for tokens issued before sessions existed
+	SessionID string
+	ExpiresAt time.Time
+}
+
+// SessionChecker reports whether the session an access token belongs to has been revoked
+type SessionChecker interface {
+	IsSessionRevoked(ctx context.Context, sessionID string) (bool, error)
+}
+
+// TokenVerifier checks the signature and expiry of an access token.
+// It is the same component AuthService signs tokens with, so both always agree on keys.
+type TokenVerifier interface {
+	Verify(tokenString string) (jwt.MapClaims, error)
+}
+
+var (
+	tokenVerifier  TokenVerifier
+	sessionChecker SessionChecker
+)
+
+var (
+	errAuthNotConfigured  = errors.New("authentication is not configured")
+	errSessionRevoked     = errors.New("session has been revoked")
+	errSessionCheckFailed = errors.New("could not verify session")
+)
+
+// ConfigureAuth sets the token verifier and the revocation check used by AuthMiddleware
+// and the WebSocket handshake. It is called once at startup, before the router starts serving requests.
+func ConfigureAuth(verifier TokenVerifier, checker SessionChecker) {
+	tokenVerifier = verifier
+	sessionChecker = checker
+}
+
+// authenticate verifies an access token and rejects tokens of revoked sessions,
+// so signing out of a device takes effect before its access token expires
+func authenticate(ctx context.Context, tokenString string) (*accessClaims, error) {
+	claims, err := parseAccessToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.SessionID == "" || sessionChecker == nil {
+		return claims, nil
+	}
+
+	revoked, err := sessionChecker.IsSessionRevoked(ctx, claims.SessionID)
+	if err != nil {
+		log.Printf("error checking session %s: %v", claims.SessionID, err)
+		return nil, errSessionCheckFailed
+	}
+	if revoked {
+		return nil, errSessionRevoked
+	}
+	return claims, nil
+}
+
+// parseAccessToken verifies the signature and expiry of an access token.
+// It is shared by AuthMiddleware and the WebSocket handshake so both apply the same rules.
+func parseAccessToken(tokenString string) (*accessClaims, error) {
+	if tokenVerifier == nil {
+		return nil, errAuthNotConfigured
+	}
+
+	claims, err := tokenVerifier.Verify(tokenString)
+	if err != nil {
+		return nil, errors.New("invalid token")
 	}
+
+	// Extract user_id from "sub" claim
+	userID, ok := claims["sub"].(string)
+	if !ok {
+		return nil, errors.New("user_id not found in token")
+	}
+
+	// Extract role from claims
+	role, _ := claims["role"].(string)
+	if role == "" {
+		role = "user" // Default role
+	}
+
+	sessionID, _ := claims["sid"].(string)
+
+	var expiresAt time.Time
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		expiresAt = exp.Time
+	}
+
+	return &accessClaims{
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
+		ExpiresAt: expiresAt,
+	}, nil
 }
 
 // RBACMiddleware creates a middleware that checks if user has one of the allowed roles
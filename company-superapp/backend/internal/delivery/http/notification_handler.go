@@ -44,7 +44,12 @@ func (h *NotificationHandler) RegisterToken(c *gin.Context) {
 		return
 	}
 
-	if err := h.notificationService.RegisterToken(c.Request.Context(), userID, req); err != nil {
+	var sessionID *uuid.UUID
+	if sid, err := uuid.Parse(c.GetString("session_id")); err == nil {
+		sessionID = &sid
+	}
+
+	if err := h.notificationService.RegisterToken(c.Request.Context(), userID, sessionID, req); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to register token"})
 		return
 	}
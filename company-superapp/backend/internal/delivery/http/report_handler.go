@@ -18,9 +18,12 @@ func NewReportHandler(reportService *service.ReportService) *ReportHandler {
 	return &ReportHandler{reportService: reportService}
 }
 
+// reportRateLimit — отчёт рендерится в PDF целиком на сервере
+var reportRateLimit = RateLimitPolicy{Name: "reports", Requests: 10, Period: time.Minute}
+
 func (h *ReportHandler) RegisterRoutes(rg *gin.RouterGroup) {
 	reports := rg.Group("/reports")
-	reports.Use(AuthMiddleware())
+	reports.Use(AuthMiddleware(), RateLimitMiddleware(reportRateLimit))
 	{
 		reports.GET("/tasks", h.GenerateTasksReport)
 	}
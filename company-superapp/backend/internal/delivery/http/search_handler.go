@@ -2,6 +2,7 @@ package http
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/yourname/company-superapp/internal/service"
@@ -15,9 +16,12 @@ func NewSearchHandler(searchService *service.GlobalSearchService) *SearchHandler
 	return &SearchHandler{searchService: searchService}
 }
 
+// searchRateLimit — каждый поиск запускает три параллельных полнотекстовых запроса
+var searchRateLimit = RateLimitPolicy{Name: "search", Requests: 30, Period: time.Minute}
+
 func (h *SearchHandler) RegisterRoutes(rg *gin.RouterGroup) {
 	search := rg.Group("/search")
-	search.Use(AuthMiddleware())
+	search.Use(AuthMiddleware(), RateLimitMiddleware(searchRateLimit))
 	{
 		search.GET("", h.Search)
 	}
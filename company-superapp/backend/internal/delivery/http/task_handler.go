@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -21,7 +22,7 @@ func (h *TaskHandler) RegisterRoutes(router *gin.RouterGroup) {
 	tasks := router.Group("/tasks")
 	{
 		tasks.POST("", h.createTask)
-		tasks.POST("/from-message", h.createFromMessage)
+		tasks.POST("/from-message", AuthMiddleware(), h.createFromMessage)
 		tasks.GET("", h.getTasks)
 		tasks.GET("/:id", h.getTask)
 		tasks.PUT("/:id", h.updateTask)
@@ -49,6 +50,7 @@ func (h *TaskHandler) createTask(c *gin.Context) {
 	c.JSON(http.StatusCreated, task)
 }
 
+// createFromMessage создаёт задачу из сообщения чата; доступно только участникам чата
 func (h *TaskHandler) createFromMessage(c *gin.Context) {
 	var input service.CreateFromMessageInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -56,11 +58,21 @@ func (h *TaskHandler) createFromMessage(c *gin.Context) {
 		return
 	}
 
-	creatorID, _ := uuid.NewRandom()
+	creatorID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
 
 	task, err := h.service.CreateFromMessage(c.Request.Context(), creatorID, input)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create task from message"})
+		switch {
+		case errors.Is(err, service.ErrMessageNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrNotChatMember):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create task from message"})
+		}
 		return
 	}
 
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourname/company-superapp/internal/service"
+)
+
+type UserHandler struct {
+	presenceService *service.PresenceService
+}
+
+func NewUserHandler(presenceService *service.PresenceService) *UserHandler {
+	return &UserHandler{presenceService: presenceService}
+}
+
+func (h *UserHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	users := rg.Group("/users")
+	users.Use(AuthMiddleware())
+	{
+		users.GET("/presence", h.getPresence)
+	}
+}
+
+// getPresence возвращает статусы пользователей: ?ids=<uuid>,<uuid>,...
+func (h *UserHandler) getPresence(c *gin.Context) {
+	var userIDs []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+	for _, raw := range strings.Split(c.Query("ids"), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		userID, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id: " + raw})
+			return
+		}
+		if !seen[userID] {
+			seen[userID] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+
+	presence, err := h.presenceService.GetPresence(c.Request.Context(), userIDs)
+	if err != nil {
+		if errors.Is(err, service.ErrNoPresenceUsers) || errors.Is(err, service.ErrTooManyPresenceUsers) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get presence"})
+		return
+	}
+	c.JSON(http.StatusOK, presence)
+}
@@ -1,13 +1,18 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/yourname/company-superapp/internal/domain"
+	"github.com/yourname/company-superapp/internal/service"
 )
 
 const (
@@ -15,6 +20,8 @@ const (
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
 	maxMessageSize = 512
+	// typingThrottle — не чаще одного события typing на чат от соединения
+	typingThrottle = 2 * time.Second
 )
 
 var upgrader = websocket.Upgrader{
@@ -30,28 +37,76 @@ type Client struct {
 	conn   *websocket.Conn
 	send   chan []byte
 	userID uuid.UUID
-	chatID uuid.UUID
+	// sessionID — сессия, которой выдан access token; при её отзыве Hub закрывает соединение
+	sessionID string
+	// chats — чаты, на которые подписан клиент; изменяет только hub.Run под hub.mu
+	chats map[uuid.UUID]bool
+	// evicting — клиент уже передан на отключение как медленный, см. Hub.trySend
+	evicting atomic.Bool
+	// closeFrame — фрейм закрытия, который writePump отправит после закрытия send; задаётся Hub.removeClient
+	closeFrame []byte
+	// expiresAt — срок действия access token; по его истечении соединение закрывается
+	expiresAt time.Time
+	// connID — идентификатор соединения в PresenceService
+	connID string
+	// typingSentAt — когда соединение последний раз отправляло typing в чат; используется только в readPump
+	typingSentAt map[uuid.UUID]time.Time
 }
 
 type IncomingMessage struct {
 	Type    string `json:"type"`
 	ChatID  string `json:"chat_id"`
 	Content string `json:"content"`
+	// MessageID — последнее прочитанное сообщение во фрейме mark_read или цель реакции в react/unreact
+	MessageID int64  `json:"message_id,omitempty"`
+	Emoji     string `json:"emoji,omitempty"`
+	// ReplyToID — сообщение, на которое отвечают; ответ попадает в его тред
+	ReplyToID *int64 `json:"reply_to_id,omitempty"`
+	// AttachmentIDs — подтверждённые вложения (POST /chats/:id/attachments)
+	AttachmentIDs []uuid.UUID `json:"attachment_ids,omitempty"`
+	// ClientMsgID — идентификатор сообщения от клиента: повтор фрейма после переподключения не создаёт дубль
+	ClientMsgID string `json:"client_msg_id,omitempty"`
 }
 
 type OutgoingMessage struct {
-	Type      string    `json:"type"`
-	ID        int64     `json:"id,omitempty"`
-	ChatID    string    `json:"chat_id"`
-	SenderID  string    `json:"sender_id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	Type         string              `json:"type"`
+	ID           int64               `json:"id,omitempty"`
+	ChatID       string              `json:"chat_id"`
+	SenderID     string              `json:"sender_id"`
+	Content      string              `json:"content"`
+	ReplyToID    *int64              `json:"reply_to_id,omitempty"`
+	ThreadRootID *int64              `json:"thread_root_id,omitempty"`
+	Attachments  []domain.Attachment `json:"attachments,omitempty"`
+	Mentions     []uuid.UUID         `json:"mentions,omitempty"`
+	ClientMsgID  *string             `json:"client_msg_id,omitempty"`
+	CreatedAt    time.Time           `json:"created_at"`
+}
+
+// AckMessage подтверждает автору, что сообщение сохранено, и сообщает его серверный ID.
+// Повтор уже сохранённого сообщения подтверждается тем же ID.
+type AckMessage struct {
+	Type        string    `json:"type"`
+	ChatID      string    `json:"chat_id"`
+	ClientMsgID string    `json:"client_msg_id,omitempty"`
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ErrorMessage отправляется только автору фрейма, который не удалось обработать
+type ErrorMessage struct {
+	Type   string `json:"type"`
+	ChatID string `json:"chat_id,omitempty"`
+	// ClientMsgID — какое сообщение не удалось отправить
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+	Error       string `json:"error"`
 }
 
 func (c *Client) readPump() {
 	defer func() {
+		chatIDs := c.hub.subscribedChats(c)
 		c.hub.unregister <- c
 		c.conn.Close()
+		c.disconnectPresence(chatIDs)
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -72,40 +127,303 @@ func (c *Client) readPump() {
 			continue
 		}
 
-		if incoming.Type == "message" {
-			chatID, _ := uuid.Parse(incoming.ChatID)
-			outgoing := OutgoingMessage{
-				Type:      "message",
-				ChatID:    incoming.ChatID,
-				SenderID:  c.userID.String(),
-				Content:   incoming.Content,
-				CreatedAt: time.Now(),
-			}
+		switch incoming.Type {
+		case "message":
+			c.handleChatMessage(incoming)
+		case "subscribe":
+			c.handleSubscribe(incoming)
+		case "unsubscribe":
+			c.handleUnsubscribe(incoming)
+		case "mark_read":
+			c.handleMarkRead(incoming)
+		case "typing":
+			c.handleTyping(incoming)
+		case "react":
+			c.handleReaction(incoming, true)
+		case "unreact":
+			c.handleReaction(incoming, false)
+		default:
+			c.sendError(incoming.ChatID, "unknown frame type")
+		}
+	}
+}
 
-			outgoingBytes, _ := json.Marshal(outgoing)
-
-			// Publish to Redis for other server instances
-			c.hub.redis.Publish(c.hub.ctx, "messages:"+chatID.String(), outgoingBytes)
-
-			// Send to all clients in the room on this instance
-			c.hub.mu.RLock()
-			if room, ok := c.hub.rooms[chatID]; ok {
-				for client := range room {
-					select {
-					case client.send <- outgoingBytes:
-					default:
-						close(client.send)
-						delete(c.hub.clients, client)
-					}
-				}
-			}
-			c.hub.mu.RUnlock()
+// handleChatMessage сохраняет сообщение через ChatService и рассылает его подписчикам чата
+func (c *Client) handleChatMessage(incoming IncomingMessage) {
+	chatID, ok := c.parseChatID(incoming)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.hub.ctx, writeWait)
+	defer cancel()
+
+	msg, created, err := c.hub.chatService.SendMessage(ctx, chatID, c.userID, service.SendMessageInput{
+		Content:       incoming.Content,
+		ReplyToID:     incoming.ReplyToID,
+		AttachmentIDs: incoming.AttachmentIDs,
+		ClientMsgID:   incoming.ClientMsgID,
+	})
+	if err != nil {
+		fail := func(message string) { c.sendMessageError(chatID.String(), incoming.ClientMsgID, message) }
+		switch {
+		case errors.Is(err, service.ErrNotChatMember):
+			fail("not a member of this chat")
+		case errors.Is(err, service.ErrEmptyMessage):
+			fail("message content is empty")
+		case errors.Is(err, service.ErrMessageNotFound):
+			fail("reply target not found")
+		case errors.Is(err, service.ErrMessageDeleted):
+			fail("cannot reply to a deleted message")
+		case errors.Is(err, service.ErrInvalidAttachment),
+			errors.Is(err, service.ErrTooManyAttachments),
+			errors.Is(err, domain.ErrAttachmentsUnavailable),
+			errors.Is(err, service.ErrInvalidClientMsgID),
+			errors.Is(err, service.ErrClientMsgIDReused):
+			fail(err.Error())
+		default:
+			log.Printf("error persisting message: %v", err)
+			fail("failed to send message")
 		}
+		return
+	}
+
+	c.sendFrame(AckMessage{
+		Type:        EventAck,
+		ChatID:      msg.ChatID.String(),
+		ClientMsgID: incoming.ClientMsgID,
+		ID:          msg.ID,
+		CreatedAt:   msg.CreatedAt,
+	})
+	if !created {
+		// Повтор: сообщение уже разослано при первой отправке
+		return
+	}
+
+	// Ответ в треде не попадает в ленту чата: клиент показывает его в треде thread_root_id
+	eventType := EventMessage
+	if msg.ThreadRootID != nil {
+		eventType = EventThreadReply
+	}
+	outgoing := OutgoingMessage{
+		Type:         eventType,
+		ID:           msg.ID,
+		ChatID:       msg.ChatID.String(),
+		SenderID:     msg.SenderID.String(),
+		Content:      msg.Content,
+		ReplyToID:    msg.ReplyToID,
+		ThreadRootID: msg.ThreadRootID,
+		Attachments:  msg.Attachments,
+		Mentions:     msg.Mentions,
+		ClientMsgID:  msg.ClientMsgID,
+		CreatedAt:    msg.CreatedAt,
+	}
+
+	// Локальные подписчики получают сообщение через тот же Redis Stream, что и остальные инстансы
+	if err := c.hub.PublishToChat(chatID, outgoing); err != nil {
+		log.Printf("error publishing message to redis: %v", err)
+		c.sendMessageError(chatID.String(), incoming.ClientMsgID, "message saved but not delivered, reload the chat")
 	}
 }
 
+// handleSubscribe подписывает соединение на чат после проверки членства
+func (c *Client) handleSubscribe(incoming IncomingMessage) {
+	chatID, ok := c.parseChatID(incoming)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.hub.ctx, writeWait)
+	defer cancel()
+
+	isMember, err := c.hub.chatService.IsMember(ctx, chatID, c.userID)
+	if err != nil {
+		log.Printf("error checking chat membership: %v", err)
+		c.sendError(chatID.String(), "failed to subscribe")
+		return
+	}
+	if !isMember {
+		c.sendError(chatID.String(), "not a member of this chat")
+		return
+	}
+
+	c.hub.Subscribe(c, chatID)
+}
+
+func (c *Client) handleUnsubscribe(incoming IncomingMessage) {
+	chatID, ok := c.parseChatID(incoming)
+	if !ok {
+		return
+	}
+
+	c.hub.Unsubscribe(c, chatID)
+}
+
+// handleMarkRead сдвигает позицию прочтения и рассылает событие read участникам чата
+func (c *Client) handleMarkRead(incoming IncomingMessage) {
+	chatID, ok := c.parseChatID(incoming)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.hub.ctx, writeWait)
+	defer cancel()
+
+	receipt, advanced, err := c.hub.chatService.MarkRead(ctx, c.userID, chatID, incoming.MessageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotChatMember):
+			c.sendError(chatID.String(), "not a member of this chat")
+		case errors.Is(err, service.ErrMessageNotFound):
+			c.sendError(chatID.String(), "message not found")
+		default:
+			log.Printf("error marking chat as read: %v", err)
+			c.sendError(chatID.String(), "failed to mark as read")
+		}
+		return
+	}
+	if advanced {
+		c.hub.NotifyRead(receipt)
+	}
+}
+
+// handleReaction ставит (add) или снимает реакцию и рассылает событие участникам чата
+func (c *Client) handleReaction(incoming IncomingMessage, add bool) {
+	chatID, ok := c.parseChatID(incoming)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.hub.ctx, writeWait)
+	defer cancel()
+
+	react := c.hub.chatService.RemoveReaction
+	if add {
+		react = c.hub.chatService.AddReaction
+	}
+	reaction, changed, err := react(ctx, c.userID, chatID, incoming.MessageID, incoming.Emoji)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotChatMember):
+			c.sendError(chatID.String(), "not a member of this chat")
+		case errors.Is(err, service.ErrMessageNotFound):
+			c.sendError(chatID.String(), "message not found")
+		case errors.Is(err, service.ErrMessageDeleted):
+			c.sendError(chatID.String(), "message has been deleted")
+		case errors.Is(err, service.ErrInvalidReaction):
+			c.sendError(chatID.String(), "invalid reaction emoji")
+		default:
+			log.Printf("error updating reaction: %v", err)
+			c.sendError(chatID.String(), "failed to update reaction")
+		}
+		return
+	}
+	if changed {
+		c.hub.NotifyReaction(reaction, add)
+	}
+}
+
+// handleTyping пересылает индикатор набора текста подписчикам чата; в БД он не сохраняется
+func (c *Client) handleTyping(incoming IncomingMessage) {
+	chatID, ok := c.parseChatID(incoming)
+	if !ok {
+		return
+	}
+	// Подписка на чат возможна только для участника, так что лишний запрос в БД не нужен
+	if !c.hub.IsSubscribed(c, chatID) {
+		c.sendError(chatID.String(), "not subscribed to this chat")
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(c.typingSentAt[chatID]) < typingThrottle {
+		return
+	}
+	c.typingSentAt[chatID] = now
+
+	event := Event{Type: EventTyping, ChatID: chatID.String(), UserID: c.userID.String()}
+	if err := c.hub.PublishToChat(chatID, event); err != nil {
+		log.Printf("error publishing typing to redis: %v", err)
+	}
+}
+
+// connectPresence отмечает соединение в PresenceService и, если пользователь только что
+// появился в сети, сообщает об этом участникам его чатов
+func (c *Client) connectPresence(chatIDs []uuid.UUID) {
+	ctx, cancel := context.WithTimeout(c.hub.ctx, writeWait)
+	defer cancel()
+
+	online, err := c.hub.presence.Connect(ctx, c.userID, c.connID)
+	if err != nil {
+		log.Printf("error registering presence for user %s: %v", c.userID, err)
+		return
+	}
+	if online {
+		c.hub.NotifyPresenceChanged(service.Presence{UserID: c.userID, Online: true}, chatIDs)
+	}
+}
+
+func (c *Client) disconnectPresence(chatIDs []uuid.UUID) {
+	ctx, cancel := context.WithTimeout(c.hub.ctx, writeWait)
+	defer cancel()
+
+	offline, err := c.hub.presence.Disconnect(ctx, c.userID, c.connID)
+	if err != nil {
+		log.Printf("error removing presence for user %s: %v", c.userID, err)
+	}
+	if offline {
+		now := time.Now().UTC()
+		c.hub.NotifyPresenceChanged(service.Presence{UserID: c.userID, LastSeen: &now}, chatIDs)
+	}
+}
+
+func (c *Client) heartbeatPresence() {
+	ctx, cancel := context.WithTimeout(c.hub.ctx, writeWait)
+	defer cancel()
+
+	if err := c.hub.presence.Heartbeat(ctx, c.userID, c.connID); err != nil {
+		log.Printf("error refreshing presence for user %s: %v", c.userID, err)
+	}
+}
+
+func (c *Client) parseChatID(incoming IncomingMessage) (uuid.UUID, bool) {
+	chatID, err := uuid.Parse(incoming.ChatID)
+	if err != nil {
+		c.sendError(incoming.ChatID, "invalid chat_id")
+		return uuid.Nil, false
+	}
+	return chatID, true
+}
+
+// sendFrame отправляет фрейм только текущему клиенту
+func (c *Client) sendFrame(frame interface{}) {
+	payload, _ := json.Marshal(frame)
+	c.hub.send(c, payload)
+}
+
+// sendError отправляет фрейм ошибки только текущему клиенту
+func (c *Client) sendError(chatID string, message string) {
+	c.sendMessageError(chatID, "", message)
+}
+
+// sendMessageError — ошибка отправки сообщения с client_msg_id, чтобы клиент знал, какое сообщение не ушло
+func (c *Client) sendMessageError(chatID, clientMsgID, message string) {
+	c.sendFrame(ErrorMessage{
+		Type:        EventError,
+		ChatID:      chatID,
+		ClientMsgID: clientMsgID,
+		Error:       message,
+	})
+}
+
 func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
+	var expired <-chan time.Time
+	if !c.expiresAt.IsZero() {
+		expiryTimer := time.NewTimer(time.Until(c.expiresAt))
+		defer expiryTimer.Stop()
+		expired = expiryTimer.C
+	}
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
@@ -115,7 +433,12 @@ func (c *Client) writePump() {
 		case message, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				// Закрытие канала в Run происходит после записи closeFrame
+				closeFrame := c.closeFrame
+				if closeFrame == nil {
+					closeFrame = []byte{}
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, closeFrame)
 				return
 			}
 
@@ -133,33 +456,53 @@ func (c *Client) writePump() {
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+			// Пинг — заодно heartbeat присутствия: PresenceTTL больше pingPeriod
+			c.heartbeatPresence()
+		case <-expired:
+			// Токен истёк: клиент должен обновить его и переподключиться
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "token expired"))
+			return
 		}
 	}
 }
 
-func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, userID uuid.UUID, chatID uuid.UUID) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// ServeWs переводит соединение в WebSocket для уже аутентифицированного пользователя
+// и подписывает его на все чаты, в которых он состоит.
+// responseHeader позволяет подтвердить выбранный клиентом Sec-WebSocket-Protocol.
+func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, userID uuid.UUID, sessionID string, expiresAt time.Time, responseHeader http.Header) {
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 	client := &Client{
-		hub:    hub,
-		conn:   conn,
-		send:   make(chan []byte, 256),
-		userID: userID,
-		chatID: chatID,
+		hub:          hub,
+		conn:         conn,
+		send:         make(chan []byte, 256),
+		userID:       userID,
+		sessionID:    sessionID,
+		chats:        make(map[uuid.UUID]bool),
+		expiresAt:    expiresAt,
+		connID:       uuid.NewString(),
+		typingSentAt: make(map[uuid.UUID]time.Time),
 	}
-	client.hub.register <- client
 
-	// Add client to the chat room
-	hub.mu.Lock()
-	if hub.rooms[chatID] == nil {
-		hub.rooms[chatID] = make(map[*Client]bool)
-		go hub.SubscribeToChat(chatID)
+	ctx, cancel := context.WithTimeout(r.Context(), writeWait)
+	chats, err := hub.chatService.GetUserChats(ctx, userID)
+	cancel()
+	if err != nil {
+		log.Printf("error loading chats for user %s: %v", userID, err)
+	}
+	// Комнаты из client.chats Hub заполняет при регистрации
+	chatIDs := make([]uuid.UUID, 0, len(chats))
+	for _, chat := range chats {
+		client.chats[chat.ID] = true
+		chatIDs = append(chatIDs, chat.ID)
 	}
-	hub.rooms[chatID][client] = true
-	hub.mu.Unlock()
+	client.hub.register <- client
+	client.connectPresence(chatIDs)
 
 	go client.writePump()
 	go client.readPump()
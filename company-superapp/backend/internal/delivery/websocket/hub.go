@@ -5,89 +5,487 @@ import (
 	"encoding/json"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/redis/go-redis/v9"
+	"github.com/yourname/company-superapp/internal/domain"
+	"github.com/yourname/company-superapp/internal/pkg/metrics"
+	"github.com/yourname/company-superapp/internal/service"
 )
 
+// Типы событий, которые сервер отправляет клиентам
+const (
+	EventMessage         = "message"
+	EventThreadReply     = "thread_reply"
+	EventAck             = "ack"
+	EventChatCreated     = "chat_created"
+	EventMemberAdded     = "member_added"
+	EventMemberRemoved   = "member_removed"
+	EventChatUpdated     = "chat_updated"
+	EventMessageEdited   = "message_edited"
+	EventMessageDeleted  = "message_deleted"
+	EventRead            = "read"
+	EventTyping          = "typing"
+	EventReactionAdded   = "reaction_added"
+	EventReactionRemoved = "reaction_removed"
+	EventPresence        = "presence_changed"
+	EventSubscribed      = "subscribed"
+	EventUnsubscribed    = "unsubscribed"
+	EventSessionRevoked  = "session_revoked"
+	EventError           = "error"
+)
+
+// Event — событие чата, рассылаемое сервером (кроме самих сообщений, см. OutgoingMessage)
+type Event struct {
+	Type   string      `json:"type"`
+	ChatID string      `json:"chat_id,omitempty"`
+	UserID string      `json:"user_id,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// MessageDeletedData — данные события message_deleted
+type MessageDeletedData struct {
+	ID        int64      `json:"id"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Hard      bool       `json:"hard"`
+}
+
+// ReadData — данные события read: до какого сообщения участник прочитал чат
+type ReadData struct {
+	LastReadMessageID int64 `json:"last_read_message_id"`
+}
+
+// ReactionData — данные событий reaction_added и reaction_removed
+type ReactionData struct {
+	MessageID int64  `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+// SessionRevokedData — данные события session_revoked; событие не доходит до клиентов,
+// Hub закрывает по нему соединения сессии
+type SessionRevokedData struct {
+	SessionID string `json:"session_id"`
+}
+
 // Hub поддерживает набор активных клиентов и транслирует сообщения клиентам.
+// Один клиент — одно соединение пользователя, подписанное на несколько чатов сразу.
+//
+// Владелец состояния — горутина Run: только она регистрирует и удаляет клиентов, меняет подписки
+// и закрывает client.send (ровно один раз, при удалении клиента). Остальные горутины передают ей
+// запросы через каналы, а сами лишь читают карты под h.mu.RLock.
 type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
+	clients map[*Client]bool
+	// users — соединения пользователя на этом инстансе
+	users map[uuid.UUID]map[*Client]bool
+	// rooms — подписки клиентов на чаты; комната удаляется, когда из неё уходит последний клиент
+	rooms      map[uuid.UUID]map[*Client]bool
 	register   chan *Client
 	unregister chan *Client
-	rooms      map[uuid.UUID]map[*Client]bool
-	mu         sync.RWMutex
-	redis      *redis.Client
-	ctx        context.Context
+	// evict — клиенты, не успевающие читать: буфер send переполнен
+	evict       chan *Client
+	roomChanges chan roomChange
+	userEvents  chan userEvent
+	// mu защищает карты от чтения во время изменения; пишет в них только Run
+	mu          sync.RWMutex
+	redis       *redis.Client
+	chatService *service.ChatService
+	presence    *service.PresenceService
+	ctx         context.Context
+}
+
+// roomChange — подписка (join) или отписка клиента от чата; reply отправляется клиенту после изменения
+type roomChange struct {
+	client *Client
+	chatID uuid.UUID
+	join   bool
+	reply  []byte
+}
+
+// userEvent — событие из потока, адресованное всем соединениям пользователя
+type userEvent struct {
+	userID  uuid.UUID
+	payload []byte
 }
 
-func NewHub(redis *redis.Client) *Hub {
+// slowConsumerClose — фрейм закрытия для клиента, у которого переполнился буфер исходящих сообщений
+var slowConsumerClose = websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "send buffer overflow")
+
+// sessionRevokedClose — фрейм закрытия соединений сессии, завершённой выходом или с другого устройства
+var sessionRevokedClose = websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session revoked")
+
+func NewHub(redis *redis.Client, chatService *service.ChatService, presence *service.PresenceService) *Hub {
+	ctx := context.Background()
 	return &Hub{
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
-		rooms:      make(map[uuid.UUID]map[*Client]bool),
-		redis:      redis,
-		ctx:        context.Background(),
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		evict:       make(chan *Client),
+		roomChanges: make(chan roomChange),
+		userEvents:  make(chan userEvent),
+		clients:     make(map[*Client]bool),
+		users:       make(map[uuid.UUID]map[*Client]bool),
+		rooms:       make(map[uuid.UUID]map[*Client]bool),
+		redis:       redis,
+		chatService: chatService,
+		presence:    presence,
+		ctx:         ctx,
 	}
 }
 
 func (h *Hub) Run() {
+	go h.listen()
+	h.loop()
+}
+
+// loop применяет регистрации, отключения и изменения подписок; события из потока приходят в него через dispatch
+func (h *Hub) loop() {
 	for {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
-			h.clients[client] = true
+			h.addClient(client)
 			h.mu.Unlock()
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				// Также удаляем из всех комнат
-				for _, room := range h.rooms {
-					delete(room, client)
-				}
-			}
+			h.removeClient(client, nil)
+			h.mu.Unlock()
+		case client := <-h.evict:
+			h.mu.Lock()
+			h.removeClient(client, slowConsumerClose)
+			h.mu.Unlock()
+		case change := <-h.roomChanges:
+			h.mu.Lock()
+			h.applyRoomChange(change)
+			h.mu.Unlock()
+		case event := <-h.userEvents:
+			h.mu.Lock()
+			h.applyUserEvent(event)
 			h.mu.Unlock()
-		case <-h.broadcast:
-			// Это для широковещательной рассылки всем клиентам, что нам может не понадобиться.
-			// Фокусируемся на сообщениях для конкретных комнат.
-			log.Println("Broadcast channel received a message, but it's not being sent to anyone.")
 		}
 	}
 }
 
-func (h *Hub) SubscribeToChat(chatId uuid.UUID) {
-	pubsub := h.redis.Subscribe(h.ctx, "messages:"+chatId.String())
-	go func() {
-		ch := pubsub.Channel()
-		for msg := range ch {
-			var messageData map[string]interface{}
-			if err := json.Unmarshal([]byte(msg.Payload), &messageData); err != nil {
-				log.Printf("error unmarshalling message from redis: %v", err)
-				continue
-			}
+// Subscribe подписывает клиента на события чата и подтверждает подписку фреймом subscribed
+func (h *Hub) Subscribe(client *Client, chatID uuid.UUID) {
+	reply, _ := json.Marshal(Event{Type: EventSubscribed, ChatID: chatID.String()})
+	h.roomChanges <- roomChange{client: client, chatID: chatID, join: true, reply: reply}
+}
 
-			h.mu.RLock()
-			room, ok := h.rooms[chatId]
-			if !ok {
-				h.mu.RUnlock()
-				continue
-			}
+// Unsubscribe отписывает клиента от событий чата и подтверждает отписку фреймом unsubscribed
+func (h *Hub) Unsubscribe(client *Client, chatID uuid.UUID) {
+	reply, _ := json.Marshal(Event{Type: EventUnsubscribed, ChatID: chatID.String()})
+	h.roomChanges <- roomChange{client: client, chatID: chatID, reply: reply}
+}
 
-			for client := range room {
-				select {
-				case client.send <- []byte(msg.Payload):
-				default:
-					close(client.send)
-					delete(h.clients, client)
-					delete(room, client)
-				}
-			}
+// PublishToChat рассылает событие всем подписчикам чата на всех инстансах
+func (h *Hub) PublishToChat(chatID uuid.UUID, payload interface{}) error {
+	return h.publish(streamTargetChat, chatID, payload)
+}
+
+// PublishToUser рассылает событие всем соединениям пользователя на всех инстансах
+func (h *Hub) PublishToUser(userID uuid.UUID, payload interface{}) error {
+	return h.publish(streamTargetUser, userID, payload)
+}
+
+// NotifyChatCreated сообщает участникам о новом чате; их соединения автоматически подписываются на него
+func (h *Hub) NotifyChatCreated(chat *domain.Chat, memberIDs []uuid.UUID) {
+	event := Event{Type: EventChatCreated, ChatID: chat.ID.String(), Data: chat}
+	for _, memberID := range memberIDs {
+		if err := h.PublishToUser(memberID, event); err != nil {
+			log.Printf("error publishing chat_created to user %s: %v", memberID, err)
+		}
+	}
+}
+
+// NotifyMemberAdded сообщает текущим участникам о новом участнике, а самого участника подписывает на чат
+func (h *Hub) NotifyMemberAdded(chatID, userID uuid.UUID) {
+	event := Event{Type: EventMemberAdded, ChatID: chatID.String(), UserID: userID.String()}
+	// Сначала событие в канал чата, чтобы новый участник не получил его дважды
+	if err := h.PublishToChat(chatID, event); err != nil {
+		log.Printf("error publishing member_added to chat %s: %v", chatID, err)
+	}
+	if err := h.PublishToUser(userID, event); err != nil {
+		log.Printf("error publishing member_added to user %s: %v", userID, err)
+	}
+}
+
+// NotifyMemberRemoved сообщает участникам об исключении или выходе участника и отписывает его соединения от чата
+func (h *Hub) NotifyMemberRemoved(chatID, userID uuid.UUID) {
+	event := Event{Type: EventMemberRemoved, ChatID: chatID.String(), UserID: userID.String()}
+	if err := h.PublishToChat(chatID, event); err != nil {
+		log.Printf("error publishing member_removed to chat %s: %v", chatID, err)
+	}
+	if err := h.PublishToUser(userID, event); err != nil {
+		log.Printf("error publishing member_removed to user %s: %v", userID, err)
+	}
+}
+
+// NotifySessionRevoked закрывает соединения отозванной сессии на всех инстансах
+func (h *Hub) NotifySessionRevoked(userID, sessionID uuid.UUID) {
+	event := Event{Type: EventSessionRevoked, UserID: userID.String(), Data: SessionRevokedData{SessionID: sessionID.String()}}
+	if err := h.PublishToUser(userID, event); err != nil {
+		log.Printf("error publishing session_revoked to user %s: %v", userID, err)
+	}
+}
+
+// NotifyChatUpdated сообщает участникам об изменении чата (например, нового названия группы)
+func (h *Hub) NotifyChatUpdated(chat *domain.Chat) {
+	event := Event{Type: EventChatUpdated, ChatID: chat.ID.String(), Data: chat}
+	if err := h.PublishToChat(chat.ID, event); err != nil {
+		log.Printf("error publishing chat_updated to chat %s: %v", chat.ID, err)
+	}
+}
+
+// NotifyMessageEdited рассылает новую версию сообщения, чтобы клиенты обновили его на месте
+func (h *Hub) NotifyMessageEdited(msg *domain.Message) {
+	event := Event{Type: EventMessageEdited, ChatID: msg.ChatID.String(), Data: msg}
+	if err := h.PublishToChat(msg.ChatID, event); err != nil {
+		log.Printf("error publishing message_edited to chat %s: %v", msg.ChatID, err)
+	}
+}
+
+// NotifyMessageDeleted рассылает надгробие удалённого сообщения (hard — сообщение удалено безвозвратно)
+func (h *Hub) NotifyMessageDeleted(msg *domain.Message, hard bool) {
+	event := Event{
+		Type:   EventMessageDeleted,
+		ChatID: msg.ChatID.String(),
+		Data: MessageDeletedData{
+			ID:        msg.ID,
+			DeletedAt: msg.DeletedAt,
+			Hard:      hard,
+		},
+	}
+	if err := h.PublishToChat(msg.ChatID, event); err != nil {
+		log.Printf("error publishing message_deleted to chat %s: %v", msg.ChatID, err)
+	}
+}
+
+// NotifyRead рассылает позицию прочтения участника: остальные видят «прочитано», его другие устройства сбрасывают счётчик
+func (h *Hub) NotifyRead(receipt *service.ReadReceipt) {
+	event := Event{
+		Type:   EventRead,
+		ChatID: receipt.ChatID.String(),
+		UserID: receipt.UserID.String(),
+		Data:   ReadData{LastReadMessageID: receipt.LastReadMessageID},
+	}
+	if err := h.PublishToChat(receipt.ChatID, event); err != nil {
+		log.Printf("error publishing read to chat %s: %v", receipt.ChatID, err)
+	}
+}
+
+// NotifyReaction рассылает участникам чата поставленную (added) или снятую реакцию
+func (h *Hub) NotifyReaction(reaction *service.Reaction, added bool) {
+	eventType := EventReactionRemoved
+	if added {
+		eventType = EventReactionAdded
+	}
+	event := Event{
+		Type:   eventType,
+		ChatID: reaction.ChatID.String(),
+		UserID: reaction.UserID.String(),
+		Data:   ReactionData{MessageID: reaction.MessageID, Emoji: reaction.Emoji},
+	}
+	if err := h.PublishToChat(reaction.ChatID, event); err != nil {
+		log.Printf("error publishing %s to chat %s: %v", eventType, reaction.ChatID, err)
+	}
+}
+
+// NotifyPresenceChanged сообщает участникам чатов пользователя, что он появился в сети или вышел из неё
+func (h *Hub) NotifyPresenceChanged(presence service.Presence, chatIDs []uuid.UUID) {
+	for _, chatID := range chatIDs {
+		event := Event{Type: EventPresence, ChatID: chatID.String(), UserID: presence.UserID.String(), Data: presence}
+		if err := h.PublishToChat(chatID, event); err != nil {
+			log.Printf("error publishing presence_changed to chat %s: %v", chatID, err)
+		}
+	}
+}
+
+// IsSubscribed проверяет, подписано ли соединение на чат
+func (h *Hub) IsSubscribed(client *Client, chatID uuid.UUID) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return client.chats[chatID]
+}
+
+// IsConnectedToChat реализует service.ChatConnectionChecker. Соединения пользователя на этом инстансе
+// проверяются по подпискам; соединения на других инстансах не видны, поэтому пользователь без локальных
+// соединений считается подключённым, если он в сети — при подключении соединение подписывается на все его чаты.
+func (h *Hub) IsConnectedToChat(ctx context.Context, userID, chatID uuid.UUID) bool {
+	h.mu.RLock()
+	conns := h.users[userID]
+	for client := range conns {
+		if client.chats[chatID] {
 			h.mu.RUnlock()
+			return true
+		}
+	}
+	hasLocal := len(conns) > 0
+	h.mu.RUnlock()
+	if hasLocal {
+		return false
+	}
+
+	online, err := h.presence.IsOnline(ctx, userID)
+	if err != nil {
+		log.Printf("error checking presence of user %s: %v", userID, err)
+		return false
+	}
+	return online
+}
+
+// subscribedChats возвращает снимок чатов, на которые подписано соединение
+func (h *Hub) subscribedChats(client *Client) []uuid.UUID {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	chatIDs := make([]uuid.UUID, 0, len(client.chats))
+	for chatID := range client.chats {
+		chatIDs = append(chatIDs, chatID)
+	}
+	return chatIDs
+}
+
+// handleUserEvent передаёт событие пользователя в Run: оно может менять подписки его соединений
+func (h *Hub) handleUserEvent(userID uuid.UUID, payload []byte) {
+	h.userEvents <- userEvent{userID: userID, payload: payload}
+}
+
+func (h *Hub) deliverToRoom(chatID uuid.UUID, payload []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.rooms[chatID] {
+		h.trySend(client, payload)
+	}
+}
+
+// send отправляет фрейм одному клиенту, если он ещё зарегистрирован
+func (h *Hub) send(client *Client, payload []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if _, ok := h.clients[client]; ok {
+		h.trySend(client, payload)
+	}
+}
+
+// trySend не блокируется: клиент с переполненным буфером отключается через Run.
+// Вызывается под h.mu, поэтому не может ни закрыть канал, ни ждать Run сама.
+func (h *Hub) trySend(client *Client, payload []byte) {
+	select {
+	case client.send <- payload:
+	default:
+		metrics.WebSocketSendDropsTotal.Inc()
+		if client.evicting.CompareAndSwap(false, true) {
+			go func() { h.evict <- client }()
+		}
+	}
+}
+
+// Методы ниже вызываются только из Run под h.mu.Lock
+
+func (h *Hub) addClient(client *Client) {
+	h.clients[client] = true
+	metrics.ActiveWebSocketConnections.Inc()
+	if h.users[client.userID] == nil {
+		h.users[client.userID] = make(map[*Client]bool)
+	}
+	h.users[client.userID][client] = true
+	for chatID := range client.chats {
+		h.joinRoom(client, chatID)
+	}
+}
+
+// removeClient удаляет клиента и закрывает его канал send; writePump отправит closeFrame
+// (или пустой фрейм закрытия, если он nil). Повторное удаление ничего не делает.
+func (h *Hub) removeClient(client *Client, closeFrame []byte) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+	metrics.ActiveWebSocketConnections.Dec()
+	for chatID := range client.chats {
+		h.leaveRoom(client, chatID)
+	}
+	if conns, ok := h.users[client.userID]; ok {
+		delete(conns, client)
+		if len(conns) == 0 {
+			delete(h.users, client.userID)
 		}
-	}()
+	}
+	client.closeFrame = closeFrame
+	close(client.send)
+}
+
+func (h *Hub) applyRoomChange(change roomChange) {
+	if _, ok := h.clients[change.client]; !ok {
+		return
+	}
+	if change.join {
+		h.joinRoom(change.client, change.chatID)
+	} else {
+		h.leaveRoom(change.client, change.chatID)
+	}
+	if change.reply != nil {
+		h.trySend(change.client, change.reply)
+	}
+}
+
+// applyUserEvent подписывает соединения пользователя на чат, в который его добавили
+// (или отписывает при исключении), и пересылает событие
+func (h *Hub) applyUserEvent(userEvent userEvent) {
+	var event Event
+	if err := json.Unmarshal(userEvent.payload, &event); err != nil {
+		log.Printf("error unmarshalling user event from redis: %v", err)
+		return
+	}
+
+	conns := h.users[userEvent.userID]
+	if event.Type == EventSessionRevoked {
+		var revoked struct {
+			Data SessionRevokedData `json:"data"`
+		}
+		json.Unmarshal(userEvent.payload, &revoked)
+		for client := range conns {
+			if client.sessionID != "" && client.sessionID == revoked.Data.SessionID {
+				h.removeClient(client, sessionRevokedClose)
+			}
+		}
+		return
+	}
+	if chatID, err := uuid.Parse(event.ChatID); err == nil {
+		switch event.Type {
+		case EventChatCreated, EventMemberAdded:
+			for client := range conns {
+				h.joinRoom(client, chatID)
+			}
+		case EventMemberRemoved:
+			for client := range conns {
+				h.leaveRoom(client, chatID)
+			}
+		}
+	}
+	for client := range conns {
+		h.trySend(client, userEvent.payload)
+	}
+}
+
+func (h *Hub) joinRoom(client *Client, chatID uuid.UUID) {
+	if h.rooms[chatID] == nil {
+		h.rooms[chatID] = make(map[*Client]bool)
+		metrics.WebSocketRooms.Inc()
+	}
+	h.rooms[chatID][client] = true
+	client.chats[chatID] = true
+}
+
+func (h *Hub) leaveRoom(client *Client, chatID uuid.UUID) {
+	delete(client.chats, chatID)
+	room, ok := h.rooms[chatID]
+	if !ok {
+		return
+	}
+	delete(room, client)
+	if len(room) == 0 {
+		delete(h.rooms, chatID)
+		metrics.WebSocketRooms.Dec()
+	}
 }
@@ -0,0 +1,187 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	stressClients = 2500
+	// stressSlowEvery — каждый такой клиент не читает send и должен быть отключён как медленный
+	stressSlowEvery = 4
+	stressUsers     = stressClients / 2
+	stressBaseChats = 40
+	stressDynChats  = 20
+	stressOps       = 20
+)
+
+type stressClient struct {
+	client *Client
+	slow   bool
+	// closeFrame — что writePump отправил бы после закрытия send
+	closeFrame []byte
+}
+
+// chatEntry и userEntry — записи потока событий в том виде, в каком их читает listen
+func chatEntry(chatID uuid.UUID) map[string]interface{} {
+	return map[string]interface{}{"target": streamTargetChat, "id": chatID.String(), "payload": `{"type":"message"}`}
+}
+
+func userEntry(userID, chatID uuid.UUID) map[string]interface{} {
+	payload, _ := json.Marshal(Event{Type: EventMemberAdded, ChatID: chatID.String(), UserID: userID.String()})
+	return map[string]interface{}{"target": streamTargetUser, "id": userID.String(), "payload": string(payload)}
+}
+
+// TestHubStress одновременно регистрирует, подписывает, отписывает и отключает тысячи клиентов,
+// пока события из потока рассылаются по комнатам и переполняют буферы медленных клиентов.
+// Запускается с -race: гонки по картам Hub и повторное закрытие send ловятся детектором и паникой.
+func TestHubStress(t *testing.T) {
+	hub := NewHub(nil, nil, nil)
+	go hub.loop()
+
+	newIDs := func(n int) []uuid.UUID {
+		ids := make([]uuid.UUID, n)
+		for i := range ids {
+			ids[i] = uuid.New()
+		}
+		return ids
+	}
+	baseChats, dynChats, users := newIDs(stressBaseChats), newIDs(stressDynChats), newIDs(stressUsers)
+
+	clients := make([]*stressClient, stressClients)
+	for i := range clients {
+		sc := &stressClient{slow: i%stressSlowEvery == 0}
+		buffer := 64
+		if sc.slow {
+			buffer = 1
+		}
+		sc.client = &Client{
+			hub:    hub,
+			send:   make(chan []byte, buffer),
+			userID: users[i%stressUsers],
+			chats:  map[uuid.UUID]bool{baseChats[i%stressBaseChats]: true},
+		}
+		clients[i] = sc
+	}
+
+	// Быстрые клиенты читают send до закрытия, как writePump
+	var drained sync.WaitGroup
+	for _, sc := range clients {
+		if sc.slow {
+			continue
+		}
+		drained.Add(1)
+		go func(sc *stressClient) {
+			defer drained.Done()
+			for range sc.client.send {
+			}
+			sc.closeFrame = sc.client.closeFrame
+		}(sc)
+	}
+
+	// Публикация: записи потока для комнат и события пользователей, пока клиенты приходят и уходят
+	stop := make(chan struct{})
+	var publishers sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		publishers.Add(1)
+		go func(seed int64) {
+			defer publishers.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if rng.Intn(10) == 0 {
+					hub.dispatch(userEntry(users[rng.Intn(len(users))], dynChats[rng.Intn(len(dynChats))]))
+				} else {
+					hub.dispatch(chatEntry(baseChats[rng.Intn(len(baseChats))]))
+				}
+				time.Sleep(50 * time.Microsecond)
+			}
+		}(int64(p))
+	}
+
+	var wg sync.WaitGroup
+	for i, sc := range clients {
+		wg.Add(1)
+		go func(i int, sc *stressClient) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(i)))
+			hub.register <- sc.client
+			for op := 0; op < stressOps; op++ {
+				chatID := dynChats[rng.Intn(len(dynChats))]
+				if rng.Intn(2) == 0 {
+					hub.Subscribe(sc.client, chatID)
+				} else {
+					hub.Unsubscribe(sc.client, chatID)
+				}
+				hub.IsSubscribed(sc.client, chatID)
+			}
+			// Медленный клиент «завис» и не уходит сам: его должен отключить Hub
+			if !sc.slow {
+				hub.subscribedChats(sc.client)
+				hub.unregister <- sc.client
+			}
+		}(i, sc)
+	}
+	wg.Wait()
+	close(stop)
+	publishers.Wait()
+
+	// Медленные клиенты остаются в своих базовых чатах: доставка в каждую комнату переполняет их буферы
+	for round := 0; round < 3; round++ {
+		for _, chatID := range baseChats {
+			hub.deliverToRoom(chatID, []byte(`{"type":"message"}`))
+		}
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		hub.mu.RLock()
+		remaining := len(hub.clients)
+		hub.mu.RUnlock()
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients are still registered", remaining)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Все читатели дождались закрытия send; повторное закрытие канала вызвало бы панику в loop
+	drained.Wait()
+
+	for i, sc := range clients {
+		if sc.slow {
+			// send закрыт: цикл завершается после оставшихся в буфере фреймов
+			for range sc.client.send {
+			}
+			sc.closeFrame = sc.client.closeFrame
+			if !bytes.Equal(sc.closeFrame, slowConsumerClose) {
+				t.Errorf("slow client %d: close frame %q, want slowConsumerClose", i, sc.closeFrame)
+			}
+			continue
+		}
+		// Быстрый клиент мог не успеть прочитать буфер и тоже быть отключён как медленный
+		if sc.closeFrame != nil && !bytes.Equal(sc.closeFrame, slowConsumerClose) {
+			t.Errorf("client %d: unexpected close frame %q", i, sc.closeFrame)
+		}
+		if sc.closeFrame != nil && !sc.client.evicting.Load() {
+			t.Errorf("client %d: got slowConsumerClose without being evicted", i)
+		}
+	}
+
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if len(hub.clients) != 0 || len(hub.users) != 0 || len(hub.rooms) != 0 {
+		t.Errorf("hub is not empty: %d clients, %d users, %d rooms", len(hub.clients), len(hub.users), len(hub.rooms))
+	}
+}
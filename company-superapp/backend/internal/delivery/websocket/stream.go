@@ -0,0 +1,153 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/company-superapp/internal/pkg/metrics"
+)
+
+const (
+	// eventStreamPrefix — Redis Streams событий WebSocket; чаты и пользователи распределены по шардам
+	eventStreamPrefix = "ws_events:"
+	eventStreamShards = 16
+	// eventStreamMaxLen — примерная длина шарда: столько последних событий переживают переподключение к Redis
+	eventStreamMaxLen = 10000
+	// eventStreamReadCount — сколько событий читается из шарда за один XREAD
+	eventStreamReadCount = 256
+	eventStreamBlock     = 5 * time.Second
+	eventStreamRetry     = time.Second
+)
+
+// Адресат события в записи потока
+const (
+	streamTargetChat = "chat"
+	streamTargetUser = "user"
+)
+
+// streamKey возвращает шард, в который пишутся события чата или пользователя id
+func streamKey(id uuid.UUID) string {
+	hash := fnv.New32a()
+	hash.Write(id[:])
+	return eventStreamPrefix + strconv.Itoa(int(hash.Sum32()%eventStreamShards))
+}
+
+// publish добавляет событие в поток; его получат все инстансы, у которых есть соединения адресата
+func (h *Hub) publish(target string, id uuid.UUID, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	// published_at — для метрики задержки доставки между инстансами
+	err = h.redis.XAdd(h.ctx, &redis.XAddArgs{
+		Stream: streamKey(id),
+		MaxLen: eventStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"target":       target,
+			"id":           id.String(),
+			"payload":      data,
+			"published_at": time.Now().UnixNano(),
+		},
+	}).Err()
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues("redis", "xadd").Inc()
+	}
+	return err
+}
+
+// listen читает все шарды событий. Позиции чтения — свои у каждого инстанса и хранятся в памяти:
+// после ошибки (например, переподключения к Redis) чтение продолжается с них,
+// поэтому события, записанные за это время, доставляются, а не теряются.
+func (h *Hub) listen() {
+	keys := make([]string, eventStreamShards)
+	for shard := range keys {
+		keys[shard] = eventStreamPrefix + strconv.Itoa(shard)
+	}
+	positions := h.streamPositions(keys)
+
+	for {
+		streams := make([]string, 0, 2*len(keys))
+		streams = append(streams, keys...)
+		for _, key := range keys {
+			streams = append(streams, positions[key])
+		}
+
+		result, err := h.redis.XRead(h.ctx, &redis.XReadArgs{
+			Streams: streams,
+			Count:   eventStreamReadCount,
+			Block:   eventStreamBlock,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if h.ctx.Err() != nil {
+				return
+			}
+			metrics.ErrorsTotal.WithLabelValues("redis", "xread").Inc()
+			log.Printf("error reading event streams: %v", err)
+			time.Sleep(eventStreamRetry)
+			continue
+		}
+
+		for _, stream := range result {
+			for _, entry := range stream.Messages {
+				positions[stream.Stream] = entry.ID
+				h.dispatch(entry.Values)
+			}
+		}
+	}
+}
+
+// streamPositions начинает чтение с последних записей шардов: история до запуска инстанса не нужна
+func (h *Hub) streamPositions(keys []string) map[string]string {
+	positions := make(map[string]string, len(keys))
+	for _, key := range keys {
+		for {
+			last, err := h.redis.XRevRangeN(h.ctx, key, "+", "-", 1).Result()
+			if err == nil {
+				positions[key] = "0-0"
+				if len(last) > 0 {
+					positions[key] = last[0].ID
+				}
+				break
+			}
+			log.Printf("error reading position of stream %s: %v", key, err)
+			time.Sleep(eventStreamRetry)
+		}
+	}
+	return positions
+}
+
+// dispatch доставляет событие из потока локальным соединениям; события адресатов без соединений
+// на этом инстансе пропускаются
+func (h *Hub) dispatch(values map[string]interface{}) {
+	target, _ := values["target"].(string)
+	rawID, _ := values["id"].(string)
+	payload, _ := values["payload"].(string)
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		log.Printf("error parsing event stream entry: %v", err)
+		return
+	}
+
+	switch target {
+	case streamTargetChat:
+		h.deliverToRoom(id, []byte(payload))
+	case streamTargetUser:
+		h.handleUserEvent(id, []byte(payload))
+	default:
+		return
+	}
+
+	if publishedAt, err := strconv.ParseInt(fmt.Sprint(values["published_at"]), 10, 64); err == nil {
+		metrics.WebSocketFanoutDuration.WithLabelValues(target).Observe(time.Since(time.Unix(0, publishedAt)).Seconds())
+	}
+}
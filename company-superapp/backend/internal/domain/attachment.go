@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AttachmentStatusPending  = "pending"
+	AttachmentStatusUploaded = "uploaded"
+)
+
+// ErrAttachmentsUnavailable возвращается MessageRepository.Create, если вложение успели
+// привязать к другому сообщению между проверкой и записью
+var ErrAttachmentsUnavailable = errors.New("attachments are no longer available")
+
+// Attachment — файл чата в MinIO; до отправки сообщения MessageID пуст
+type Attachment struct {
+	ID          uuid.UUID `json:"id" db:"id"`
+	ChatID      uuid.UUID `json:"chat_id" db:"chat_id"`
+	MessageID   *int64    `json:"message_id,omitempty" db:"message_id"`
+	UploaderID  uuid.UUID `json:"uploader_id" db:"uploader_id"`
+	ObjectKey   string    `json:"-" db:"object_key"`
+	FileName    string    `json:"file_name" db:"file_name"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	Size        int64     `json:"size" db:"size"`
+	Status      string    `json:"status" db:"status"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+type AttachmentRepository interface {
+	Create(ctx context.Context, attachment *Attachment) error
+	// GetByID не возвращает вложения удалённых сообщений
+	GetByID(ctx context.Context, id uuid.UUID) (*Attachment, error)
+	GetByIDs(ctx context.Context, ids []uuid.UUID) ([]Attachment, error)
+	// GetByMessageIDs возвращает вложения, сгруппированные по ID сообщения
+	GetByMessageIDs(ctx context.Context, messageIDs []int64) (map[int64][]Attachment, error)
+	// MarkUploaded отмечает проверенный файл загруженным и сохраняет его постоянный ObjectKey
+	MarkUploaded(ctx context.Context, attachment *Attachment) error
+}
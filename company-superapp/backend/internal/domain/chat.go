@@ -7,14 +7,69 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	ChatTypePrivate = "private"
+	ChatTypeGroup   = "group"
+)
+
+const (
+	ChatRoleOwner  = "owner"
+	ChatRoleMember = "member"
+)
+
 type Chat struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	Type      string    `json:"type" db:"type"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID         uuid.UUID  `json:"id" db:"id"`
+	Type       string     `json:"type" db:"type"`
+	Name       *string    `json:"name,omitempty" db:"name"`
+	CreatedBy  *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	PrivateKey *string    `json:"-" db:"private_key"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ChatSummary — чат в списке пользователя со счётчиком непрочитанных и последним сообщением
+type ChatSummary struct {
+	Chat
+	LastReadMessageID int64 `json:"last_read_message_id" db:"last_read_message_id"`
+	// UnreadCount не учитывает собственные и удалённые сообщения пользователя
+	UnreadCount int `json:"unread_count" db:"unread_count"`
+	// LastMessage — превью последнего сообщения (текст обрезан), nil в пустом чате
+	LastMessage *Message `json:"last_message,omitempty" db:"-"`
+	// Muted — уведомления чата отключены; MutedUntil пуст, если до ручного включения
+	Muted      bool       `json:"muted" db:"muted"`
+	MutedUntil *time.Time `json:"muted_until,omitempty" db:"muted_until"`
+}
+
+// ChatMember — участник чата вместе с публичными данными пользователя
+type ChatMember struct {
+	ChatID            uuid.UUID `json:"chat_id" db:"chat_id"`
+	UserID            uuid.UUID `json:"user_id" db:"user_id"`
+	Role              string    `json:"role" db:"role"`
+	JoinedAt          time.Time `json:"joined_at" db:"joined_at"`
+	LastReadMessageID int64     `json:"last_read_message_id" db:"last_read_message_id"`
+	Email             string    `json:"email" db:"email"`
+	FullName          *string   `json:"full_name,omitempty" db:"full_name"`
 }
 
 type ChatRepository interface {
 	Create(ctx context.Context, chat *Chat) error
+	CreateWithMembers(ctx context.Context, chat *Chat, ownerID uuid.UUID, memberIDs []uuid.UUID) error
+	// CreatePrivate создаёт личный чат двух пользователей или возвращает существующий (created = false)
+	CreatePrivate(ctx context.Context, chat *Chat, userA, userB uuid.UUID) (bool, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*Chat, error)
+	UpdateName(ctx context.Context, chatID uuid.UUID, name string) error
 	AddMember(ctx context.Context, chatID, userID uuid.UUID) error
-	GetChatsByUserID(ctx context.Context, userID uuid.UUID) ([]Chat, error)
+	RemoveMember(ctx context.Context, chatID, userID uuid.UUID) error
+	// TransferOwnership назначает владельцем участника, вступившего раньше остальных
+	TransferOwnership(ctx context.Context, chatID uuid.UUID) error
+	GetMember(ctx context.Context, chatID, userID uuid.UUID) (*ChatMember, error)
+	GetMembers(ctx context.Context, chatID uuid.UUID) ([]ChatMember, error)
+	// GetChatsByUserID возвращает чаты пользователя, начиная с последних по активности
+	GetChatsByUserID(ctx context.Context, userID uuid.UUID) ([]ChatSummary, error)
+	IsMember(ctx context.Context, chatID, userID uuid.UUID) (bool, error)
+	// MarkRead сдвигает позицию прочтения вперёд; false, если она уже не меньше messageID
+	MarkRead(ctx context.Context, chatID, userID uuid.UUID, messageID int64) (bool, error)
+	// SetMute отключает (muted = true) или включает уведомления чата для участника
+	SetMute(ctx context.Context, chatID, userID uuid.UUID, muted bool, until *time.Time) error
+	// GetUnmutedMemberIDs возвращает участников, у которых уведомления чата сейчас включены
+	GetUnmutedMemberIDs(ctx context.Context, chatID uuid.UUID) ([]uuid.UUID, error)
 }
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserIdentity — привязка пользователя к аккаунту во внешнем IdP (OpenID Connect)
+type UserIdentity struct {
+	ID     int64     `db:"id" json:"id"`
+	UserID uuid.UUID `db:"user_id" json:"user_id"`
+	// Issuer и Subject — claims iss и sub из id_token
+	Issuer      string    `db:"issuer" json:"issuer"`
+	Subject     string    `db:"subject" json:"subject"`
+	Email       string    `db:"email" json:"email"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	LastLoginAt time.Time `db:"last_login_at" json:"last_login_at"`
+}
+
+type IdentityRepository interface {
+	FindBySubject(ctx context.Context, issuer, subject string) (*UserIdentity, error)
+	// Create привязывает аккаунт IdP к существующему пользователю
+	Create(ctx context.Context, identity *UserIdentity) error
+	// CreateWithUser создаёт пользователя с подтверждённым email и привязку к IdP в одной транзакции
+	CreateWithUser(ctx context.Context, user *User, identity *UserIdentity) error
+	// TouchLogin обновляет время входа и email из последнего id_token
+	TouchLogin(ctx context.Context, id int64, email string) error
+}
@@ -8,14 +8,67 @@ import (
 )
 
 type Message struct {
-	ID        int64     `json:"id" db:"id"`
-	ChatID    uuid.UUID `json:"chat_id" db:"chat_id"`
-	SenderID  uuid.UUID `json:"sender_id" db:"sender_id"`
-	Content   string    `json:"content" db:"content"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID        int64      `json:"id" db:"id"`
+	ChatID    uuid.UUID  `json:"chat_id" db:"chat_id"`
+	SenderID  uuid.UUID  `json:"sender_id" db:"sender_id"`
+	Content   string     `json:"content" db:"content"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty" db:"edited_at"`
+	// DeletedAt заполнен у удалённых сообщений: остаётся «надгробие» без текста
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	// ReplyToID — сообщение, на которое отвечают; ThreadRootID — корень треда, в который попал ответ
+	ReplyToID    *int64 `json:"reply_to_id,omitempty" db:"reply_to_id"`
+	ThreadRootID *int64 `json:"thread_root_id,omitempty" db:"thread_root_id"`
+	// ThreadReplyCount заполняется только в истории чата
+	ThreadReplyCount int `json:"thread_reply_count,omitempty" db:"thread_reply_count"`
+	// Reactions заполняется в истории чата и треда
+	Reactions []ReactionSummary `json:"reactions,omitempty" db:"-"`
+	// Attachments — загруженные файлы сообщения; при создании привязываются к нему
+	Attachments []Attachment `json:"attachments,omitempty" db:"-"`
+	// Mentions — упомянутые участники чата; заполняется при отправке и сохраняется вместе с сообщением
+	Mentions []uuid.UUID `json:"mentions,omitempty" db:"-"`
+	// ClientMsgID — идентификатор, сгенерированный клиентом; уникален в пределах отправителя
+	ClientMsgID *string `json:"client_msg_id,omitempty" db:"client_msg_id"`
+}
+
+// MessageEdit — предыдущая версия отредактированного сообщения
+type MessageEdit struct {
+	ID              int64      `json:"id" db:"id"`
+	MessageID       int64      `json:"message_id" db:"message_id"`
+	PreviousContent string     `json:"previous_content" db:"previous_content"`
+	EditedBy        *uuid.UUID `json:"edited_by,omitempty" db:"edited_by"`
+	EditedAt        time.Time  `json:"edited_at" db:"edited_at"`
+}
+
+// MessageCursor задаёт окно keyset-пагинации по messages.id.
+// BeforeID — страница более старых сообщений (от новых к старым),
+// AfterID — более новых (от старых к новым), без курсора — последние сообщения.
+type MessageCursor struct {
+	BeforeID *int64
+	AfterID  *int64
+	Limit    int
 }
 
 type MessageRepository interface {
-	Create(ctx context.Context, msg *Message) error
-	GetMessagesByChatID(ctx context.Context, chatID uuid.UUID, limit, offset int) ([]Message, error)
+	// Create сохраняет сообщение и в той же транзакции привязывает к нему msg.Attachments и msg.Mentions.
+	// Если у отправителя уже есть сообщение с msg.ClientMsgID, msg заполняется им и created = false.
+	Create(ctx context.Context, msg *Message) (bool, error)
+	GetByID(ctx context.Context, id int64) (*Message, error)
+	GetByClientMsgID(ctx context.Context, senderID uuid.UUID, clientMsgID string) (*Message, error)
+	// GetMessagesByChatID возвращает сообщения вне тредов с числом ответов в треде каждого из них
+	GetMessagesByChatID(ctx context.Context, chatID uuid.UUID, cursor MessageCursor) ([]Message, error)
+	// GetThreadReplies возвращает ответы треда; порядок и курсор — как в GetMessagesByChatID
+	GetThreadReplies(ctx context.Context, rootID int64, cursor MessageCursor) ([]Message, error)
+	// GetMessagesSince возвращает сообщения всех чатов пользователя с id > sinceID по возрастанию id, без ответов в тредах
+	GetMessagesSince(ctx context.Context, userID uuid.UUID, sinceID int64, limit int) ([]Message, error)
+	// UpdateContent сохраняет текущий текст в историю правок и заменяет его новым
+	UpdateContent(ctx context.Context, msg *Message, editorID uuid.UUID, content string) error
+	// SoftDelete стирает текст, оставляя запись-надгробие; последний текст сохраняется в истории правок
+	SoftDelete(ctx context.Context, msg *Message) error
+	// HardDelete удаляет сообщение вместе с ответами в его треде
+	HardDelete(ctx context.Context, id int64) error
+	GetEdits(ctx context.Context, messageID int64) ([]MessageEdit, error)
+	// GetMentions возвращает неудалённые сообщения с упоминанием пользователя из чатов, где он состоит,
+	// от новых к старым; из курсора используется только BeforeID
+	GetMentions(ctx context.Context, userID uuid.UUID, cursor MessageCursor) ([]Message, error)
 }
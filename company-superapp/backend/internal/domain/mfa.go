@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserMFA — настройка TOTP пользователя; секрет хранится зашифрованным
+type UserMFA struct {
+	UserID              uuid.UUID `db:"user_id" json:"user_id"`
+	TOTPSecretEncrypted []byte    `db:"totp_secret_encrypted" json:"-"`
+	// EnabledAt пуст, пока настройка не подтверждена первым кодом
+	EnabledAt    *time.Time `db:"enabled_at" json:"enabled_at,omitempty"`
+	LastUsedStep int64      `db:"last_used_step" json:"-"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+}
+
+type MFARepository interface {
+	GetByUserID(ctx context.Context, userID uuid.UUID) (*UserMFA, error)
+	// SavePending начинает настройку заново: новый секрет, MFA выключен, коды восстановления удалены
+	SavePending(ctx context.Context, userID uuid.UUID, secretEncrypted []byte) error
+	// Enable включает MFA и заменяет коды восстановления
+	Enable(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) error
+	Delete(ctx context.Context, userID uuid.UUID) error
+	// UseStep запоминает принятый шаг TOTP; false, если этот или более поздний шаг уже использован
+	UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
+	// UseRecoveryCode гасит код восстановления; false, если кода нет или он уже использован
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+	CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error)
+}
@@ -12,7 +12,9 @@ type PushToken struct {
 	UserID     uuid.UUID `db:"user_id" json:"user_id"`
 	Token      string    `db:"token" json:"token"`
 	DeviceInfo *string   `db:"device_info" json:"device_info,omitempty"`
-	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	// SessionID — сессия входа, в которой зарегистрирован токен
+	SessionID *uuid.UUID `db:"session_id" json:"session_id,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
 }
 
 type PushTokenRepository interface {
@@ -21,4 +23,5 @@ type PushTokenRepository interface {
 	GetByToken(ctx context.Context, token string) (*PushToken, error)
 	Delete(ctx context.Context, token string) error
 	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+	DeleteBySessionID(ctx context.Context, sessionID uuid.UUID) error
 }
@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// ReactionSummary — реакции одним эмодзи на сообщение
+type ReactionSummary struct {
+	Emoji       string `json:"emoji" db:"emoji"`
+	Count       int    `json:"count" db:"count"`
+	ReactedByMe bool   `json:"reacted_by_me" db:"reacted_by_me"`
+}
+
+type ReactionRepository interface {
+	// Add возвращает false, если пользователь уже поставил эту реакцию
+	Add(ctx context.Context, messageID int64, userID uuid.UUID, emoji string) (bool, error)
+	// Remove возвращает false, если такой реакции не было
+	Remove(ctx context.Context, messageID int64, userID uuid.UUID, emoji string) (bool, error)
+	// GetSummaries возвращает реакции на сообщения, сгруппированные по ID сообщения;
+	// ReactedByMe считается относительно userID
+	GetSummaries(ctx context.Context, messageIDs []int64, userID uuid.UUID) (map[int64][]ReactionSummary, error)
+}
@@ -24,6 +24,7 @@ type Task struct {
 	AssigneeID      *uuid.UUID `json:"assignee_id,omitempty" db:"assignee_id"`
 	DueDate         *time.Time `json:"due_date,omitempty" db:"due_date"`
 	SourceMessageID *int64     `json:"source_message_id,omitempty" db:"source_message_id"`
+	SourceThreadID  *int64     `json:"source_thread_id,omitempty" db:"source_thread_id"`
 	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
 }
@@ -15,10 +15,18 @@ type User struct {
 	FullName     string    `json:"full_name,omitempty" db:"full_name"`
 	Role         string    `json:"role" db:"role"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	// EmailVerifiedAt пуст, пока пользователь не перешёл по ссылке из письма
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" db:"email_verified_at"`
 }
 
 // UserRepository определяет интерфейс для работы с хранилищем пользователей.
 type UserRepository interface {
 	Create(ctx context.Context, user *User) error
 	FindByEmail(ctx context.Context, email string) (*User, error)
+	FindByID(ctx context.Context, id uuid.UUID) (*User, error)
+	FindByIDs(ctx context.Context, ids []uuid.UUID) ([]User, error)
+	// MarkEmailVerified подтверждает email; повторное подтверждение не меняет дату
+	MarkEmailVerified(ctx context.Context, id uuid.UUID) error
+	UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error
+	UpdateRole(ctx context.Context, id uuid.UUID, role string) error
 }
@@ -0,0 +1,275 @@
+package authtoken
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yourname/company-superapp/internal/config"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var (
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrUnknownKey         = errors.New("token is signed with an unknown key")
+	ErrUnsupportedAlg     = errors.New("unsupported JWT algorithm")
+	ErrMissingSigningKey  = errors.New("JWT_SIGNING_KEY_FILE is required for asymmetric algorithms")
+	ErrUnsupportedKeyType = errors.New("unsupported key type, expected RSA or Ed25519")
+)
+
+// key — ключ проверки подписи; у ключа подписи также заполнен signKey
+type key struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// Manager выпускает и проверяет JWT. Токены подписываются одним текущим ключом,
+// а проверяются любым из известных: так при ротации токены, подписанные прежним ключом,
+// остаются действительными до истечения
+type Manager struct {
+	signing *key
+	keys    map[string]*key
+	// ordered — ключи в порядке настройки, начиная с ключа подписи
+	ordered []*key
+}
+
+// NewManager создаёт Manager по настройкам JWT: для HS256 — из секрета,
+// для RS256/EdDSA — из PEM закрытого ключа и публичных ключей прежних подписей
+func NewManager(cfg config.JWTConfig) (*Manager, error) {
+	var signing *key
+	switch cfg.Algorithm {
+	case AlgorithmHS256:
+		sum := sha256.Sum256([]byte(cfg.Secret))
+		signing = &key{
+			id:        "hs-" + hex.EncodeToString(sum[:4]),
+			method:    jwt.SigningMethodHS256,
+			signKey:   []byte(cfg.Secret),
+			verifyKey: []byte(cfg.Secret),
+		}
+	case AlgorithmRS256, AlgorithmEdDSA:
+		if cfg.SigningKeyFile == "" {
+			return nil, ErrMissingSigningKey
+		}
+		var err error
+		signing, err = loadPrivateKey(cfg.SigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if signing.method.Alg() != cfg.Algorithm {
+			return nil, fmt.Errorf("%s: key type does not match JWT_ALGORITHM %s", cfg.SigningKeyFile, cfg.Algorithm)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, cfg.Algorithm)
+	}
+
+	m := &Manager{signing: signing, keys: map[string]*key{signing.id: signing}, ordered: []*key{signing}}
+	for _, path := range cfg.VerificationKeyFiles {
+		k, err := loadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := m.keys[k.id]; !exists {
+			m.keys[k.id] = k
+			m.ordered = append(m.ordered, k)
+		}
+	}
+	return m, nil
+}
+
+// Sign подписывает claims текущим ключом и указывает его в заголовке kid
+func (m *Manager) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(m.signing.method, claims)
+	token.Header["kid"] = m.signing.id
+	return token.SignedString(m.signing.signKey)
+}
+
+// Verify проверяет подпись и срок действия access token. Токены с claim aud (одноразовые ссылки
+// из писем) не принимаются, чтобы их нельзя было предъявить вместо access token
+func (m *Manager) Verify(tokenString string) (jwt.MapClaims, error) {
+	claims, err := m.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := claims["aud"]; ok {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// VerifyAudience проверяет токен, выпущенный для одного назначения (claim aud)
+func (m *Manager) VerifyAudience(tokenString, audience string) (jwt.MapClaims, error) {
+	return m.parse(tokenString, jwt.WithAudience(audience))
+}
+
+// parse проверяет подпись ключом из заголовка kid. Токен без kid (выпущенный до ротации ключей)
+// проверяется текущим ключом подписи
+func (m *Manager) parse(tokenString string, opts ...jwt.ParserOption) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		k := m.signing
+		if kid, ok := token.Header["kid"].(string); ok {
+			if k, ok = m.keys[kid]; !ok {
+				return nil, ErrUnknownKey
+			}
+		}
+		// Алгоритм задаётся ключом, а не заголовком токена
+		if token.Method.Alg() != k.method.Alg() {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return k.verifyKey, nil
+	}, opts...)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// JWK — публичный ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// N и E — модуль и экспонента RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Crv и X — кривая и публичный ключ Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает публичные ключи проверки подписи. Секрет HS256 не публикуется,
+// поэтому в этом режиме набор пуст
+func (m *Manager) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range m.ordered {
+		jwk := JWK{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+		switch pub := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func loadPrivateKey(path string) (*key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed interface{}
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", path, ErrUnsupportedKeyType)
+	}
+	k, err := newPublicKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	k.signKey = signer
+	return k, nil
+}
+
+func loadPublicKey(path string) (*key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed interface{}
+	if block.Type == "RSA PUBLIC KEY" {
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	k, err := newPublicKey(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return k, nil
+}
+
+// newPublicKey определяет алгоритм по типу ключа, kid — отпечаток публичного ключа,
+// поэтому один и тот же ключ получает одинаковый kid на всех инстансах
+func newPublicKey(pub interface{}) (*key, error) {
+	var method jwt.SigningMethod
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, ErrUnsupportedKeyType
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	return &key{
+		id:        base64.RawURLEncoding.EncodeToString(sum[:12]),
+		method:    method,
+		verifyKey: pub,
+	}, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block, nil
+}
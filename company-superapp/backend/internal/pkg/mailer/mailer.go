@@ -0,0 +1,117 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yourname/company-superapp/internal/config"
+)
+
+// Message — текстовое письмо одному получателю
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer отправляет письма; реализации взаимозаменяемы и выбираются настройкой MAIL_DRIVER
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New создаёт Mailer по настройкам: smtp — реальная отправка (в том числе на локальный
+// SMTP-стенд вроде Mailpit), log — письма только логируются и сохраняются в MAIL_DIR
+func New(cfg config.MailConfig) (Mailer, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, from), nil
+	case "log":
+		return NewLogMailer(cfg.Dir, from), nil
+	default:
+		return nil, fmt.Errorf("unsupported MAIL_DRIVER %q", cfg.Driver)
+	}
+}
+
+// LogMailer — реализация для разработки: получатель и тема пишутся в лог, а письмо целиком,
+// если задан каталог, — в .eml-файл, который открывается любым почтовым клиентом
+type LogMailer struct {
+	dir  string
+	from *mail.Address
+}
+
+func NewLogMailer(dir string, from *mail.Address) *LogMailer {
+	return &LogMailer{dir: dir, from: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	// Тело не логируется: в нём ссылки подтверждения email и сброса пароля
+	slog.Info("Письмо (MAIL_DRIVER=log)", "to", msg.To, "subject", msg.Subject)
+	if m.dir == "" {
+		return nil
+	}
+
+	data, err := buildMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102T150405.000000000") + ".eml"
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o644)
+}
+
+// buildMessage собирает письмо в формате RFC 5322: тема кодируется для кириллицы,
+// тело — quoted-printable в UTF-8
+func buildMessage(from *mail.Address, msg Message) ([]byte, error) {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domainOf(from.Address))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	body := quotedprintable.NewWriter(&buf)
+	if _, err := body.Write([]byte(msg.Body)); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func domainOf(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
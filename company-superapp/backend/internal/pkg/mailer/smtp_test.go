@@ -0,0 +1,161 @@
+package mailer
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourname/company-superapp/internal/config"
+)
+
+// smtpSession — что получил fakeSMTPServer за одно соединение
+type smtpSession struct {
+	auth string
+	from string
+	rcpt []string
+	data string
+	err  error
+}
+
+// fakeSMTPServer принимает одно соединение и отвечает на EHLO, AUTH PLAIN, MAIL, RCPT, DATA и QUIT
+// как обычный SMTP-сервер без STARTTLS (локальный стенд вроде Mailpit)
+func fakeSMTPServer(t *testing.T) (int, <-chan smtpSession) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		var session smtpSession
+		defer func() { sessions <- session }()
+
+		conn, err := listener.Accept()
+		if err != nil {
+			session.err = err
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		text := textproto.NewConn(conn)
+
+		text.PrintfLine("220 localhost fake SMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				session.err = err
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				text.PrintfLine("250-localhost")
+				text.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				mechanism, initial, _ := strings.Cut(arg, " ")
+				credentials, err := base64.StdEncoding.DecodeString(initial)
+				if mechanism != "PLAIN" || err != nil {
+					text.PrintfLine("504 unsupported authentication")
+					continue
+				}
+				session.auth = string(credentials)
+				text.PrintfLine("235 authenticated")
+			case "MAIL":
+				session.from = arg
+				text.PrintfLine("250 OK")
+			case "RCPT":
+				session.rcpt = append(session.rcpt, arg)
+				text.PrintfLine("250 OK")
+			case "DATA":
+				text.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+				data, err := text.ReadDotBytes()
+				if err != nil {
+					session.err = err
+					return
+				}
+				session.data = string(data)
+				text.PrintfLine("250 queued")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				return
+			default:
+				text.PrintfLine("502 command not implemented")
+			}
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, sessions
+}
+
+// TestSMTPMailerSendsVerificationEmail отправляет письмо подтверждения через драйвер smtp
+// и проверяет, что сервер получил адресата, тему на кириллице и ссылку из тела без искажений
+func TestSMTPMailerSendsVerificationEmail(t *testing.T) {
+	port, sessions := fakeSMTPServer(t)
+	m, err := New(config.MailConfig{
+		Driver:       "smtp",
+		From:         "Company SuperApp <noreply@company.local>",
+		SMTPHost:     "127.0.0.1",
+		SMTPPort:     port,
+		SMTPUsername: "mailer",
+		SMTPPassword: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Длинный токен с символами, которые quoted-printable обязан экранировать, и переносом строки внутри ссылки
+	link := "http://localhost:3000/verify-email?token=" + strings.Repeat("eyJhbGciOiJIUzI1NiJ9.a=b_", 6)
+	msg := Message{
+		To:      "Alice <alice@company.local>",
+		Subject: "Подтверждение email",
+		Body:    "Здравствуйте!\n\nЧтобы подтвердить адрес и войти в Company SuperApp, перейдите по ссылке:\n" + link + "\n",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, msg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	session := <-sessions
+	if session.err != nil {
+		t.Fatalf("smtp session: %v", session.err)
+	}
+	if session.auth != "\x00mailer\x00secret" {
+		t.Fatalf("AUTH PLAIN credentials %q", session.auth)
+	}
+	if session.from != "FROM:<noreply@company.local>" {
+		t.Fatalf("MAIL %q", session.from)
+	}
+	if len(session.rcpt) != 1 || session.rcpt[0] != "TO:<alice@company.local>" {
+		t.Fatalf("RCPT %q", session.rcpt)
+	}
+
+	received, err := mail.ReadMessage(strings.NewReader(session.data))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(received.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Fatalf("subject %q (%v), want %q", subject, err, msg.Subject)
+	}
+	if to, err := received.Header.AddressList("To"); err != nil || len(to) != 1 || to[0].Address != "alice@company.local" {
+		t.Fatalf("To header %v (%v)", to, err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(received.Body))
+	if err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if !strings.Contains(string(body), "\n"+link+"\n") {
+		t.Fatalf("body does not contain the verification link:\n%s", body)
+	}
+}
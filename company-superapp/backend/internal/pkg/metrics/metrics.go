@@ -43,6 +43,32 @@ var (
 		},
 	)
 
+	// WebSocketRooms отслеживает чаты, на которые подписано хотя бы одно соединение инстанса
+	WebSocketRooms = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "websocket_rooms_active",
+			Help: "Number of chats with at least one subscribed WebSocket connection",
+		},
+	)
+
+	// WebSocketSendDropsTotal подсчитывает фреймы, не поместившиеся в буфер медленного клиента
+	WebSocketSendDropsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "websocket_send_buffer_drops_total",
+			Help: "Total number of WebSocket frames dropped because the client send buffer was full",
+		},
+	)
+
+	// WebSocketFanoutDuration отслеживает задержку от записи события в Redis Stream до доставки локальным клиентам
+	WebSocketFanoutDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "websocket_fanout_duration_seconds",
+			Help:    "Latency between publishing an event to Redis and delivering it to local WebSocket clients",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+		},
+		[]string{"target"},
+	)
+
 	// MessagesTotal подсчитывает общее количество отправленных сообщений
 	MessagesTotal = promauto.NewCounter(
 		prometheus.CounterOpts{
@@ -59,6 +85,24 @@ var (
 		},
 	)
 
+	// PushNotificationsTotal подсчитывает отправленные push-уведомления о сообщениях
+	PushNotificationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "push_notifications_total",
+			Help: "Total number of chat push notifications dispatched to users",
+		},
+		[]string{"type"},
+	)
+
+	// RateLimitRejectionsTotal подсчитывает запросы, отклонённые ограничением частоты (429)
+	RateLimitRejectionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rate_limit_rejections_total",
+			Help: "Total number of requests rejected by rate limiting",
+		},
+		[]string{"policy"},
+	)
+
 	// ErrorsTotal подсчитывает общее количество ошибок
 	ErrorsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -0,0 +1,360 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yourname/company-superapp/internal/config"
+)
+
+var (
+	ErrIssuerMismatch = errors.New("issuer in the discovery document does not match OIDC_ISSUER_URL")
+	ErrTokenExchange  = errors.New("authorization code exchange failed")
+	ErrInvalidIDToken = errors.New("invalid id_token")
+	ErrUnknownKey     = errors.New("id_token is signed with an unknown key")
+)
+
+const (
+	// metadataTTL — как долго кэшируются discovery-документ и ключи IdP
+	metadataTTL = time.Hour
+	// keyRefreshInterval — не чаще этого ключи перечитываются из-за неизвестного kid (ротация в IdP)
+	keyRefreshInterval = time.Minute
+	// clockSkew — допустимое расхождение часов с IdP при проверке exp и iat
+	clockSkew = time.Minute
+	// maxResponseSize — ограничение ответа IdP
+	maxResponseSize = 1 << 20
+)
+
+// signingAlgs — алгоритмы подписи id_token; "none" и HMAC не принимаются
+var signingAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// metadata — нужная часть discovery-документа (OpenID Connect Discovery 1.0)
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider — клиент одного IdP: authorization code flow с PKCE и проверка id_token.
+// Discovery-документ и ключи загружаются при первом входе и кэшируются,
+// поэтому недоступный IdP не мешает запуску сервера
+type Provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	httpClient   *http.Client
+
+	mu            sync.Mutex
+	meta          *metadata
+	metaFetchedAt time.Time
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+func NewProvider(cfg config.OIDCConfig) *Provider {
+	return &Provider{
+		issuer:       cfg.IssuerURL,
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		redirectURL:  cfg.RedirectURL,
+		scopes:       cfg.Scopes,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Issuer — идентификатор IdP; вместе с sub однозначно определяет аккаунт пользователя
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// AuthCodeURL возвращает адрес страницы входа IdP. state защищает от подмены ответа,
+// nonce привязывает id_token к этому входу, codeChallenge — S256 от code_verifier (RFC 7636)
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.clientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", strings.Join(p.scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// TokenResponse — ответ token endpoint
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Exchange обменивает code на токены. Без OIDC_CLIENT_SECRET клиент считается публичным,
+// и от подмены code защищает только PKCE
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*TokenResponse, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"code_verifier": {codeVerifier},
+		"client_id":     {p.clientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		// client_secret_basic: RFC 6749 требует form-кодирования id и секрета перед Basic
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		_ = json.Unmarshal(body, &oauthErr)
+		return nil, fmt.Errorf("%w: status %d: %s %s", ErrTokenExchange, resp.StatusCode, oauthErr.Error, oauthErr.Description)
+	}
+
+	var tokens TokenResponse
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenExchange, err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: response has no id_token", ErrTokenExchange)
+	}
+	return &tokens, nil
+}
+
+// IDToken — проверенные claims id_token
+type IDToken struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	// AMR — способы аутентификации в IdP (RFC 8176), например pwd, otp, mfa
+	AMR    []string
+	Claims jwt.MapClaims
+}
+
+// VerifyIDToken проверяет подпись ключом IdP, iss, aud, срок действия и nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (*IDToken, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods(signingAlgs),
+		jwt.WithIssuer(p.issuer),
+		jwt.WithAudience(p.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	// Токен для нескольких получателей должен быть выдан именно этому клиенту (OIDC Core 3.1.3.7)
+	if audience, _ := claims.GetAudience(); len(audience) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.clientID {
+			return nil, fmt.Errorf("%w: azp does not match client_id", ErrInvalidIDToken)
+		}
+	}
+	tokenNonce, _ := claims["nonce"].(string)
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, fmt.Errorf("%w: sub is empty", ErrInvalidIDToken)
+	}
+
+	idToken := &IDToken{Subject: subject, Claims: claims}
+	idToken.Email, _ = claims["email"].(string)
+	idToken.Name, _ = claims["name"].(string)
+	idToken.AMR, _ = idToken.Strings("amr")
+	// Некоторые IdP передают email_verified строкой
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		idToken.EmailVerified = verified
+	case string:
+		idToken.EmailVerified = verified == "true"
+	}
+	return idToken, nil
+}
+
+// Strings возвращает claim со списком строк; одиночная строка считается списком из одного значения.
+// ok = false, если claim отсутствует
+func (t *IDToken) Strings(claim string) ([]string, bool) {
+	raw, ok := t.Claims[claim]
+	if !ok {
+		return nil, false
+	}
+	switch value := raw.(type) {
+	case string:
+		return []string{value}, true
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values, true
+	}
+	return nil, true
+}
+
+// RandomString возвращает случайное значение для state, nonce и code_verifier
+func RandomString() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// CodeChallenge — PKCE code_challenge методом S256
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil && time.Since(p.metaFetchedAt) < metadataTTL {
+		return p.meta, nil
+	}
+
+	var meta metadata
+	if err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		// IdP временно недоступен — продолжаем с прежними метаданными
+		if p.meta != nil {
+			return p.meta, nil
+		}
+		return nil, err
+	}
+	if meta.Issuer != p.issuer {
+		return nil, fmt.Errorf("%w: %s", ErrIssuerMismatch, meta.Issuer)
+	}
+	p.meta, p.metaFetchedAt = &meta, time.Now()
+	return p.meta, nil
+}
+
+// key возвращает ключ проверки подписи. Неизвестный kid означает ротацию ключей в IdP,
+// поэтому набор перечитывается, но не чаще keyRefreshInterval
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	k, found := p.lookupKey(kid)
+	stale := time.Since(p.keysFetchedAt) > metadataTTL
+	if found && !stale {
+		return k, nil
+	}
+	if p.keys == nil || stale || time.Since(p.keysFetchedAt) > keyRefreshInterval {
+		var set struct {
+			Keys []jsonWebKey `json:"keys"`
+		}
+		if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+			if found {
+				return k, nil
+			}
+			return nil, err
+		}
+		keys := make(map[string]interface{}, len(set.Keys))
+		for _, jwk := range set.Keys {
+			if jwk.Use != "" && jwk.Use != "sig" {
+				continue
+			}
+			// Ключи неподдерживаемых типов пропускаются: ими не подписываются принимаемые токены
+			if pub, err := jwk.publicKey(); err == nil {
+				keys[jwk.Kid] = pub
+			}
+		}
+		p.keys, p.keysFetchedAt = keys, time.Now()
+		k, found = p.lookupKey(kid)
+	}
+	if !found {
+		return nil, ErrUnknownKey
+	}
+	return k, nil
+}
+
+// lookupKey ищет ключ по kid; токен без kid принимается, только если у IdP один ключ
+func (p *Provider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+func (p *Provider) getJSON(ctx context.Context, endpoint string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(target)
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Result — решение лимитера для одного запроса
+type Result struct {
+	Allowed bool
+	Limit   int
+	// Remaining — сколько запросов ещё можно сделать в текущем окне
+	Remaining int
+	// RetryAfter — через сколько освободится место, если запрос отклонён
+	RetryAfter time.Duration
+	// Reset — через сколько лимит восстановится полностью (заполняется TokenBucket)
+	Reset time.Duration
+}
+
+// slidingWindowScript хранит время каждого запроса в ZSET и считает только попавшие в окно.
+// Время берётся у Redis, чтобы инстансы с расходящимися часами считали одинаково
+var slidingWindowScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if count >= limit then
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	return {0, 0, tonumber(oldest[2]) + window - now}
+end
+
+redis.call('ZADD', KEYS[1], now, ARGV[3])
+redis.call('PEXPIRE', KEYS[1], window)
+return {1, limit - count - 1, 0}
+`)
+
+// SlidingWindow пропускает не больше limit запросов за любой отрезок длиной window
+type SlidingWindow struct {
+	redis  *redis.Client
+	prefix string
+	limit  int
+	window time.Duration
+}
+
+func NewSlidingWindow(redisClient *redis.Client, prefix string, limit int, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{
+		redis:  redisClient,
+		prefix: prefix,
+		limit:  limit,
+		window: window,
+	}
+}
+
+// Allow учитывает запрос с ключом key, если лимит не исчерпан; отклонённые запросы не учитываются
+func (l *SlidingWindow) Allow(ctx context.Context, key string) (*Result, error) {
+	values, err := slidingWindowScript.Run(ctx, l.redis, []string{l.prefix + key},
+		l.window.Milliseconds(), l.limit, uuid.NewString()).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Allowed:    values[0] == 1,
+		Limit:      l.limit,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
+
+// Reset забывает все запросы ключа
+func (l *SlidingWindow) Reset(ctx context.Context, key string) error {
+	return l.redis.Del(ctx, l.prefix+key).Err()
+}
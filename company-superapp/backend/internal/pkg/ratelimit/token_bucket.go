@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript пополняет корзину по прошедшему времени и забирает один токен.
+// Состояние — HASH с дробным числом токенов и временем последнего обращения (мс, по часам Redis)
+var tokenBucketScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate))
+return {allowed, math.floor(tokens), retry, math.ceil((capacity - tokens) / rate)}
+`)
+
+// TokenBucket допускает всплеск до capacity запросов и восстанавливает capacity токенов за period
+type TokenBucket struct {
+	redis    *redis.Client
+	prefix   string
+	capacity int
+	period   time.Duration
+}
+
+func NewTokenBucket(redisClient *redis.Client, prefix string, capacity int, period time.Duration) *TokenBucket {
+	return &TokenBucket{
+		redis:    redisClient,
+		prefix:   prefix,
+		capacity: capacity,
+		period:   period,
+	}
+}
+
+// Allow забирает токен для ключа key; без свободного токена запрос отклоняется
+func (b *TokenBucket) Allow(ctx context.Context, key string) (*Result, error) {
+	ratePerMs := float64(b.capacity) / float64(b.period.Milliseconds())
+	values, err := tokenBucketScript.Run(ctx, b.redis, []string{b.prefix + key}, b.capacity, ratePerMs).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Allowed:    values[0] == 1,
+		Limit:      b.capacity,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		Reset:      time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
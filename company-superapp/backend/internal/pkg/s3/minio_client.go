@@ -2,8 +2,12 @@ package s3
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime"
+	"net/http"
 	"net/url"
 	"os"
 	"time"
@@ -12,6 +16,15 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
+// ErrObjectNotFound возвращается StatObject, если объекта нет в bucket
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo — метаданные загруженного объекта
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+}
+
 type MinioClient struct {
 	client     *minio.Client
 	bucketName string
@@ -94,6 +107,86 @@ func (m *MinioClient) GeneratePresignedDownloadURL(ctx context.Context, objectKe
 	return presignedURL.String(), nil
 }
 
+// GeneratePresignedUploadURLWithContentType подписывает PUT вместе с заголовком Content-Type:
+// загрузить по такой ссылке можно только файл заявленного типа
+func (m *MinioClient) GeneratePresignedUploadURLWithContentType(ctx context.Context, objectKey string, contentType string) (string, error) {
+	expiry := 15 * time.Minute
+
+	headers := make(http.Header)
+	headers.Set("Content-Type", contentType)
+
+	presignedURL, err := m.client.PresignHeader(ctx, http.MethodPut, m.bucketName, objectKey, expiry, nil, headers)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
+	}
+
+	return presignedURL.String(), nil
+}
+
+// GeneratePresignedDownloadURLAs возвращает ссылку на скачивание, при которой браузер сохранит файл под именем fileName
+func (m *MinioClient) GeneratePresignedDownloadURLAs(ctx context.Context, objectKey string, fileName string) (string, error) {
+	expiry := 1 * time.Hour
+
+	reqParams := make(url.Values)
+	reqParams.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+
+	presignedURL, err := m.client.PresignedGetObject(ctx, m.bucketName, objectKey, expiry, reqParams)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate presigned download URL: %w", err)
+	}
+
+	return presignedURL.String(), nil
+}
+
+// StatObject возвращает размер и тип загруженного объекта
+func (m *MinioClient) StatObject(ctx context.Context, objectKey string) (*ObjectInfo, error) {
+	info, err := m.client.StatObject(ctx, m.bucketName, objectKey, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	return &ObjectInfo{Size: info.Size, ContentType: info.ContentType}, nil
+}
+
+// ReadObjectHead возвращает первые n байт объекта, не скачивая его целиком
+func (m *MinioClient) ReadObjectHead(ctx context.Context, objectKey string, n int64) ([]byte, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(0, n-1); err != nil {
+		return nil, err
+	}
+	object, err := m.client.GetObject(ctx, m.bucketName, objectKey, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	defer object.Close()
+
+	head, err := io.ReadAll(io.LimitReader(object, n))
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	return head, nil
+}
+
+// CopyObject копирует объект внутри bucket; ErrObjectNotFound — исходного объекта нет
+func (m *MinioClient) CopyObject(ctx context.Context, srcKey, dstKey string) error {
+	_, err := m.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: m.bucketName, Object: dstKey},
+		minio.CopySrcOptions{Bucket: m.bucketName, Object: srcKey})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return ErrObjectNotFound
+		}
+		return fmt.Errorf("failed to copy object: %w", err)
+	}
+	return nil
+}
+
 func (m *MinioClient) DeleteObject(ctx context.Context, objectKey string) error {
 	return m.client.RemoveObject(ctx, m.bucketName, objectKey, minio.RemoveObjectOptions{})
 }
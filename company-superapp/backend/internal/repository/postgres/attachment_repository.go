@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/yourname/company-superapp/internal/domain"
+)
+
+type AttachmentRepository struct {
+	db *DB
+}
+
+func NewAttachmentRepository(db *sqlx.DB) *AttachmentRepository {
+	return &AttachmentRepository{db: instrument(db)}
+}
+
+const attachmentColumns = `a.id, a.chat_id, a.message_id, a.uploader_id, a.object_key, a.file_name,
+						   a.content_type, a.size, a.status, a.created_at`
+
+func (r *AttachmentRepository) Create(ctx context.Context, attachment *domain.Attachment) error {
+	query := `INSERT INTO messenger.attachments (id, chat_id, uploader_id, object_key, file_name, content_type, size, status)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING created_at`
+	return r.db.QueryRowxContext(ctx, query,
+		attachment.ID, attachment.ChatID, attachment.UploaderID, attachment.ObjectKey,
+		attachment.FileName, attachment.ContentType, attachment.Size, attachment.Status,
+	).Scan(&attachment.CreatedAt)
+}
+
+func (r *AttachmentRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Attachment, error) {
+	var attachment domain.Attachment
+	query := `SELECT ` + attachmentColumns + ` FROM messenger.attachments a
+			  LEFT JOIN messenger.messages m ON m.id = a.message_id
+			  WHERE a.id = $1 AND m.deleted_at IS NULL`
+	err := r.db.GetContext(ctx, &attachment, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &attachment, err
+}
+
+func (r *AttachmentRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]domain.Attachment, error) {
+	var attachments []domain.Attachment
+	query := `SELECT ` + attachmentColumns + ` FROM messenger.attachments a WHERE a.id = ANY($1)`
+	err := r.db.SelectContext(ctx, &attachments, query, pq.Array(ids))
+	return attachments, err
+}
+
+func (r *AttachmentRepository) GetByMessageIDs(ctx context.Context, messageIDs []int64) (map[int64][]domain.Attachment, error) {
+	result := make(map[int64][]domain.Attachment)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	var attachments []domain.Attachment
+	query := `SELECT ` + attachmentColumns + ` FROM messenger.attachments a
+			  JOIN messenger.messages m ON m.id = a.message_id
+			  WHERE a.message_id = ANY($1) AND m.deleted_at IS NULL
+			  ORDER BY a.message_id, a.created_at`
+	if err := r.db.SelectContext(ctx, &attachments, query, pq.Array(messageIDs)); err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		result[*attachment.MessageID] = append(result[*attachment.MessageID], attachment)
+	}
+	return result, nil
+}
+
+func (r *AttachmentRepository) MarkUploaded(ctx context.Context, attachment *domain.Attachment) error {
+	query := `UPDATE messenger.attachments SET status = $1, content_type = $2, size = $3, object_key = $4 WHERE id = $5`
+	_, err := r.db.ExecContext(ctx, query, domain.AttachmentStatusUploaded, attachment.ContentType, attachment.Size, attachment.ObjectKey, attachment.ID)
+	if err != nil {
+		return err
+	}
+	attachment.Status = domain.AttachmentStatusUploaded
+	return nil
+}
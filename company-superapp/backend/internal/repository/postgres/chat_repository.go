@@ -2,6 +2,9 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -9,11 +12,30 @@ import (
 )
 
 type ChatRepository struct {
-	db *sqlx.DB
+	db *DB
 }
 
 func NewChatRepository(db *sqlx.DB) *ChatRepository {
-	return &ChatRepository{db: db}
+	return &ChatRepository{db: instrument(db)}
+}
+
+const chatColumns = `c.id, c.type, c.name, c.created_by, c.private_key, c.created_at`
+
+const chatMemberColumns = `cm.chat_id, cm.user_id, cm.role, cm.joined_at, cm.last_read_message_id, u.email, u.full_name`
+
+// chatSummaryRow — строка списка чатов; поля последнего сообщения NULL в пустом чате
+type chatSummaryRow struct {
+	domain.Chat
+	LastReadMessageID    int64      `db:"last_read_message_id"`
+	UnreadCount          int        `db:"unread_count"`
+	Muted                bool       `db:"muted"`
+	MutedUntil           *time.Time `db:"muted_until"`
+	LastMessageID        *int64     `db:"last_message_id"`
+	LastMessageSenderID  *uuid.UUID `db:"last_message_sender_id"`
+	LastMessageContent   *string    `db:"last_message_content"`
+	LastMessageCreatedAt *time.Time `db:"last_message_created_at"`
+	LastMessageEditedAt  *time.Time `db:"last_message_edited_at"`
+	LastMessageDeletedAt *time.Time `db:"last_message_deleted_at"`
 }
 
 func (r *ChatRepository) Create(ctx context.Context, chat *domain.Chat) error {
@@ -21,17 +43,209 @@ func (r *ChatRepository) Create(ctx context.Context, chat *domain.Chat) error {
 	return r.db.QueryRowxContext(ctx, query, chat.Type).Scan(&chat.ID, &chat.CreatedAt)
 }
 
+func (r *ChatRepository) CreateWithMembers(ctx context.Context, chat *domain.Chat, ownerID uuid.UUID, memberIDs []uuid.UUID) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO messenger.chats (type, name, created_by) VALUES ($1, $2, $3) RETURNING id, created_at`
+	if err := tx.QueryRowxContext(ctx, query, chat.Type, chat.Name, chat.CreatedBy).Scan(&chat.ID, &chat.CreatedAt); err != nil {
+		return err
+	}
+
+	memberQuery := `INSERT INTO messenger.chat_members (chat_id, user_id, role) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, memberQuery, chat.ID, ownerID, domain.ChatRoleOwner); err != nil {
+		return err
+	}
+	for _, memberID := range memberIDs {
+		if memberID == ownerID {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, memberQuery, chat.ID, memberID, domain.ChatRoleMember); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *ChatRepository) CreatePrivate(ctx context.Context, chat *domain.Chat, userA, userB uuid.UUID) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO messenger.chats (type, created_by, private_key) VALUES ($1, $2, $3)
+			  ON CONFLICT (private_key) DO NOTHING
+			  RETURNING id, created_at`
+	err = tx.QueryRowxContext(ctx, query, domain.ChatTypePrivate, chat.CreatedBy, chat.PrivateKey).Scan(&chat.ID, &chat.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Чат для этой пары уже существует
+		existing := `SELECT ` + chatColumns + ` FROM messenger.chats c WHERE c.private_key = $1`
+		if err := tx.GetContext(ctx, chat, existing, chat.PrivateKey); err != nil {
+			return false, err
+		}
+		return false, tx.Commit()
+	}
+	if err != nil {
+		return false, err
+	}
+
+	memberQuery := `INSERT INTO messenger.chat_members (chat_id, user_id, role) VALUES ($1, $2, $3)`
+	for _, userID := range []uuid.UUID{userA, userB} {
+		if _, err := tx.ExecContext(ctx, memberQuery, chat.ID, userID, domain.ChatRoleMember); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+func (r *ChatRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Chat, error) {
+	var chat domain.Chat
+	query := `SELECT ` + chatColumns + ` FROM messenger.chats c WHERE c.id = $1`
+	err := r.db.GetContext(ctx, &chat, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &chat, err
+}
+
+func (r *ChatRepository) UpdateName(ctx context.Context, chatID uuid.UUID, name string) error {
+	query := `UPDATE messenger.chats SET name = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, name, chatID)
+	return err
+}
+
 func (r *ChatRepository) AddMember(ctx context.Context, chatID, userID uuid.UUID) error {
 	query := `INSERT INTO messenger.chat_members (chat_id, user_id) VALUES ($1, $2)`
 	_, err := r.db.ExecContext(ctx, query, chatID, userID)
 	return err
 }
 
-func (r *ChatRepository) GetChatsByUserID(ctx context.Context, userID uuid.UUID) ([]domain.Chat, error) {
-	var chats []domain.Chat
-	query := `SELECT c.id, c.type, c.created_at FROM messenger.chats c
+func (r *ChatRepository) RemoveMember(ctx context.Context, chatID, userID uuid.UUID) error {
+	query := `DELETE FROM messenger.chat_members WHERE chat_id = $1 AND user_id = $2`
+	_, err := r.db.ExecContext(ctx, query, chatID, userID)
+	return err
+}
+
+func (r *ChatRepository) TransferOwnership(ctx context.Context, chatID uuid.UUID) error {
+	query := `UPDATE messenger.chat_members SET role = 'owner'
+			  WHERE chat_id = $1 AND user_id = (
+				  SELECT user_id FROM messenger.chat_members
+				  WHERE chat_id = $1 ORDER BY joined_at, user_id LIMIT 1
+			  )`
+	_, err := r.db.ExecContext(ctx, query, chatID)
+	return err
+}
+
+func (r *ChatRepository) GetMember(ctx context.Context, chatID, userID uuid.UUID) (*domain.ChatMember, error) {
+	var member domain.ChatMember
+	query := `SELECT ` + chatMemberColumns + `
+			  FROM messenger.chat_members cm
+			  JOIN system.users u ON u.id = cm.user_id
+			  WHERE cm.chat_id = $1 AND cm.user_id = $2`
+	err := r.db.GetContext(ctx, &member, query, chatID, userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &member, err
+}
+
+func (r *ChatRepository) GetMembers(ctx context.Context, chatID uuid.UUID) ([]domain.ChatMember, error) {
+	var members []domain.ChatMember
+	query := `SELECT ` + chatMemberColumns + `
+			  FROM messenger.chat_members cm
+			  JOIN system.users u ON u.id = cm.user_id
+			  WHERE cm.chat_id = $1
+			  ORDER BY cm.joined_at, cm.user_id`
+	err := r.db.SelectContext(ctx, &members, query, chatID)
+	return members, err
+}
+
+func (r *ChatRepository) GetChatsByUserID(ctx context.Context, userID uuid.UUID) ([]domain.ChatSummary, error) {
+	var rows []chatSummaryRow
+	// Превью ограничено 200 символами, чтобы не тянуть длинные сообщения в список чатов
+	// Истёкшее отключение уведомлений показывается как включённые уведомления
+	// Ответы в тредах, как и в истории, не учитываются ни в непрочитанных, ни в последнем сообщении
+	query := `SELECT ` + chatColumns + `, cm.last_read_message_id,
+				  (cm.muted AND (cm.muted_until IS NULL OR cm.muted_until > NOW())) AS muted,
+				  CASE WHEN cm.muted AND cm.muted_until > NOW() THEN cm.muted_until END AS muted_until,
+				  (SELECT COUNT(*) FROM messenger.messages um
+				   WHERE um.chat_id = c.id AND um.id > cm.last_read_message_id
+					 AND um.sender_id <> cm.user_id AND um.deleted_at IS NULL
+					 AND um.thread_root_id IS NULL) AS unread_count,
+				  lm.id AS last_message_id, lm.sender_id AS last_message_sender_id,
+				  lm.content AS last_message_content, lm.created_at AS last_message_created_at,
+				  lm.edited_at AS last_message_edited_at, lm.deleted_at AS last_message_deleted_at
+			  FROM messenger.chats c
 			  JOIN messenger.chat_members cm ON c.id = cm.chat_id
-			  WHERE cm.user_id = $1`
-	err := r.db.SelectContext(ctx, &chats, query, userID)
-	return chats, err
+			  LEFT JOIN LATERAL (
+				  SELECT id, sender_id, LEFT(content, 200) AS content, created_at, edited_at, deleted_at
+				  FROM messenger.messages WHERE chat_id = c.id AND thread_root_id IS NULL ORDER BY id DESC LIMIT 1
+			  ) lm ON TRUE
+			  WHERE cm.user_id = $1
+			  ORDER BY COALESCE(lm.created_at, c.created_at) DESC`
+	if err := r.db.SelectContext(ctx, &rows, query, userID); err != nil {
+		return nil, err
+	}
+
+	chats := make([]domain.ChatSummary, 0, len(rows))
+	for _, row := range rows {
+		summary := domain.ChatSummary{
+			Chat:              row.Chat,
+			LastReadMessageID: row.LastReadMessageID,
+			UnreadCount:       row.UnreadCount,
+			Muted:             row.Muted,
+			MutedUntil:        row.MutedUntil,
+		}
+		if row.LastMessageID != nil {
+			summary.LastMessage = &domain.Message{
+				ID:        *row.LastMessageID,
+				ChatID:    row.ID,
+				SenderID:  *row.LastMessageSenderID,
+				Content:   *row.LastMessageContent,
+				CreatedAt: *row.LastMessageCreatedAt,
+				EditedAt:  row.LastMessageEditedAt,
+				DeletedAt: row.LastMessageDeletedAt,
+			}
+		}
+		chats = append(chats, summary)
+	}
+	return chats, nil
+}
+
+func (r *ChatRepository) IsMember(ctx context.Context, chatID, userID uuid.UUID) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM messenger.chat_members WHERE chat_id = $1 AND user_id = $2)`
+	err := r.db.GetContext(ctx, &exists, query, chatID, userID)
+	return exists, err
+}
+
+func (r *ChatRepository) MarkRead(ctx context.Context, chatID, userID uuid.UUID, messageID int64) (bool, error) {
+	query := `UPDATE messenger.chat_members SET last_read_message_id = $3
+			  WHERE chat_id = $1 AND user_id = $2 AND last_read_message_id < $3`
+	result, err := r.db.ExecContext(ctx, query, chatID, userID, messageID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *ChatRepository) SetMute(ctx context.Context, chatID, userID uuid.UUID, muted bool, until *time.Time) error {
+	query := `UPDATE messenger.chat_members SET muted = $1, muted_until = $2 WHERE chat_id = $3 AND user_id = $4`
+	_, err := r.db.ExecContext(ctx, query, muted, until, chatID, userID)
+	return err
+}
+
+func (r *ChatRepository) GetUnmutedMemberIDs(ctx context.Context, chatID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	query := `SELECT user_id FROM messenger.chat_members
+			  WHERE chat_id = $1 AND NOT (muted AND (muted_until IS NULL OR muted_until > NOW()))`
+	err := r.db.SelectContext(ctx, &ids, query, chatID)
+	return ids, err
 }
@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/yourname/company-superapp/internal/pkg/metrics"
+)
+
+// DB — sqlx.DB, который записывает длительность каждого запроса в metrics.DBQueryDuration
+// с операцией (select, insert, ...) и таблицей, определёнными по тексту запроса
+type DB struct {
+	*sqlx.DB
+}
+
+// Tx — транзакция DB с теми же метриками
+type Tx struct {
+	*sqlx.Tx
+}
+
+func instrument(db *sqlx.DB) *DB {
+	return &DB{DB: db}
+}
+
+func (db *DB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx}, nil
+}
+
+func (db *DB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	defer observeQuery(query, time.Now())
+	err := db.DB.GetContext(ctx, dest, query, args...)
+	countQueryError(query, err)
+	return err
+}
+
+func (db *DB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	defer observeQuery(query, time.Now())
+	err := db.DB.SelectContext(ctx, dest, query, args...)
+	countQueryError(query, err)
+	return err
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(query, time.Now())
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	countQueryError(query, err)
+	return result, err
+}
+
+// QueryRowxContext и QueryRowContext измеряют выполнение запроса; ошибки приходят позже, из Scan
+func (db *DB) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	defer observeQuery(query, time.Now())
+	return db.DB.QueryRowxContext(ctx, query, args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer observeQuery(query, time.Now())
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (tx *Tx) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	defer observeQuery(query, time.Now())
+	err := tx.Tx.GetContext(ctx, dest, query, args...)
+	countQueryError(query, err)
+	return err
+}
+
+func (tx *Tx) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	defer observeQuery(query, time.Now())
+	err := tx.Tx.SelectContext(ctx, dest, query, args...)
+	countQueryError(query, err)
+	return err
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(query, time.Now())
+	result, err := tx.Tx.ExecContext(ctx, query, args...)
+	countQueryError(query, err)
+	return result, err
+}
+
+func (tx *Tx) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	defer observeQuery(query, time.Now())
+	return tx.Tx.QueryRowxContext(ctx, query, args...)
+}
+
+// queryLabels — операция и таблица запроса
+type queryLabels struct {
+	operation string
+	table     string
+}
+
+// queryTablePattern находит первую таблицу запроса: после FROM, INTO или UPDATE
+var queryTablePattern = regexp.MustCompile(`(?i)\b(?:from|into|update)\s+([a-z_][a-z0-9_.]*)`)
+
+// queryLabelCache — метки уже разобранных запросов; тексты запросов в репозиториях постоянны
+var queryLabelCache sync.Map
+
+func labelsOf(query string) queryLabels {
+	if cached, ok := queryLabelCache.Load(query); ok {
+		return cached.(queryLabels)
+	}
+	labels := queryLabels{operation: "unknown", table: "unknown"}
+	if fields := strings.Fields(query); len(fields) > 0 {
+		labels.operation = strings.ToLower(fields[0])
+	}
+	if match := queryTablePattern.FindStringSubmatch(query); match != nil {
+		labels.table = strings.ToLower(match[1])
+	}
+	queryLabelCache.Store(query, labels)
+	return labels
+}
+
+func observeQuery(query string, start time.Time) {
+	labels := labelsOf(query)
+	metrics.DBQueryDuration.WithLabelValues(labels.operation, labels.table).Observe(time.Since(start).Seconds())
+}
+
+// countQueryError учитывает ошибки БД; sql.ErrNoRows — обычный результат «не найдено»
+func countQueryError(query string, err error) {
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	metrics.ErrorsTotal.WithLabelValues("db", labelsOf(query).operation).Inc()
+}
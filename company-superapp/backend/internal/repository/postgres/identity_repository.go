@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/yourname/company-superapp/internal/domain"
+)
+
+type IdentityRepository struct {
+	db *DB
+}
+
+func NewIdentityRepository(db *sqlx.DB) *IdentityRepository {
+	return &IdentityRepository{db: instrument(db)}
+}
+
+func (r *IdentityRepository) FindBySubject(ctx context.Context, issuer, subject string) (*domain.UserIdentity, error) {
+	var identity domain.UserIdentity
+	query := `SELECT id, user_id, issuer, subject, email, created_at, last_login_at
+			  FROM system.user_identities WHERE issuer = $1 AND subject = $2`
+	err := r.db.GetContext(ctx, &identity, query, issuer, subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *IdentityRepository) Create(ctx context.Context, identity *domain.UserIdentity) error {
+	query := `INSERT INTO system.user_identities (user_id, issuer, subject, email)
+			  VALUES ($1, $2, $3, $4) RETURNING id, created_at, last_login_at`
+	return r.db.QueryRowxContext(ctx, query, identity.UserID, identity.Issuer, identity.Subject, identity.Email).
+		Scan(&identity.ID, &identity.CreatedAt, &identity.LastLoginAt)
+}
+
+func (r *IdentityRepository) CreateWithUser(ctx context.Context, user *domain.User, identity *domain.UserIdentity) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userQuery := `INSERT INTO system.users (email, password_hash, full_name, role, email_verified_at)
+				  VALUES ($1, $2, $3, $4, NOW()) RETURNING id, created_at, email_verified_at`
+	if err := tx.QueryRowxContext(ctx, userQuery, user.Email, user.PasswordHash, user.FullName, user.Role).
+		Scan(&user.ID, &user.CreatedAt, &user.EmailVerifiedAt); err != nil {
+		return err
+	}
+
+	identity.UserID = user.ID
+	identityQuery := `INSERT INTO system.user_identities (user_id, issuer, subject, email)
+					  VALUES ($1, $2, $3, $4) RETURNING id, created_at, last_login_at`
+	if err := tx.QueryRowxContext(ctx, identityQuery, identity.UserID, identity.Issuer, identity.Subject, identity.Email).
+		Scan(&identity.ID, &identity.CreatedAt, &identity.LastLoginAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *IdentityRepository) TouchLogin(ctx context.Context, id int64, email string) error {
+	query := `UPDATE system.user_identities SET last_login_at = NOW(), email = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, email, id)
+	return err
+}
@@ -2,29 +2,240 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/yourname/company-superapp/internal/domain"
 )
 
 type MessageRepository struct {
-	db *sqlx.DB
+	db *DB
 }
 
 func NewMessageRepository(db *sqlx.DB) *MessageRepository {
-	return &MessageRepository{db: db}
+	return &MessageRepository{db: instrument(db)}
 }
 
-func (r *MessageRepository) Create(ctx context.Context, msg *domain.Message) error {
-	query := `INSERT INTO messenger.messages (chat_id, sender_id, content) VALUES ($1, $2, $3) RETURNING id, created_at`
-	return r.db.QueryRowxContext(ctx, query, msg.ChatID, msg.SenderID, msg.Content).Scan(&msg.ID, &msg.CreatedAt)
+const messageColumns = `m.id, m.chat_id, m.sender_id, m.content, m.created_at, m.edited_at, m.deleted_at,
+						  m.reply_to_id, m.thread_root_id, m.client_msg_id`
+
+// threadReplyCountColumn — число неудалённых ответов в треде сообщения
+const threadReplyCountColumn = `(SELECT COUNT(*) FROM messenger.messages r
+								 WHERE r.thread_root_id = m.id AND r.deleted_at IS NULL) AS thread_reply_count`
+
+func (r *MessageRepository) Create(ctx context.Context, msg *domain.Message) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO messenger.messages (chat_id, sender_id, content, reply_to_id, thread_root_id, client_msg_id)
+			  VALUES ($1, $2, $3, $4, $5, $6)
+			  ON CONFLICT (sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL DO NOTHING
+			  RETURNING id, created_at`
+	err = tx.QueryRowxContext(ctx, query, msg.ChatID, msg.SenderID, msg.Content, msg.ReplyToID, msg.ThreadRootID, msg.ClientMsgID).
+		Scan(&msg.ID, &msg.CreatedAt)
+	if err == sql.ErrNoRows {
+		// Повторная отправка: сообщение с этим client_msg_id уже сохранено параллельным запросом
+		existing := `SELECT ` + messageColumns + ` FROM messenger.messages m
+					 WHERE m.sender_id = $1 AND m.client_msg_id = $2`
+		senderID, clientMsgID := msg.SenderID, msg.ClientMsgID
+		*msg = domain.Message{}
+		if err := tx.GetContext(ctx, msg, existing, senderID, clientMsgID); err != nil {
+			return false, err
+		}
+		return false, tx.Commit()
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if len(msg.Attachments) > 0 {
+		ids := make([]uuid.UUID, len(msg.Attachments))
+		for i, attachment := range msg.Attachments {
+			ids[i] = attachment.ID
+		}
+		// Условие message_id IS NULL защищает от привязки одного файла к двум сообщениям
+		attachQuery := `UPDATE messenger.attachments SET message_id = $1
+						WHERE id = ANY($2) AND chat_id = $3 AND uploader_id = $4
+						  AND status = 'uploaded' AND message_id IS NULL`
+		result, err := tx.ExecContext(ctx, attachQuery, msg.ID, pq.Array(ids), msg.ChatID, msg.SenderID)
+		if err != nil {
+			return false, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		if affected != int64(len(ids)) {
+			return false, domain.ErrAttachmentsUnavailable
+		}
+		for i := range msg.Attachments {
+			msg.Attachments[i].MessageID = &msg.ID
+		}
+	}
+
+	if len(msg.Mentions) > 0 {
+		mentionQuery := `INSERT INTO messenger.mentions (message_id, user_id, chat_id)
+						 SELECT $1, unnest($2::uuid[]), $3`
+		if _, err := tx.ExecContext(ctx, mentionQuery, msg.ID, pq.Array(msg.Mentions), msg.ChatID); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+func (r *MessageRepository) GetByID(ctx context.Context, id int64) (*domain.Message, error) {
+	var msg domain.Message
+	query := `SELECT ` + messageColumns + ` FROM messenger.messages m WHERE m.id = $1`
+	err := r.db.GetContext(ctx, &msg, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &msg, err
+}
+
+func (r *MessageRepository) GetByClientMsgID(ctx context.Context, senderID uuid.UUID, clientMsgID string) (*domain.Message, error) {
+	var msg domain.Message
+	query := `SELECT ` + messageColumns + ` FROM messenger.messages m WHERE m.sender_id = $1 AND m.client_msg_id = $2`
+	err := r.db.GetContext(ctx, &msg, query, senderID, clientMsgID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &msg, err
+}
+
+func (r *MessageRepository) GetMessagesByChatID(ctx context.Context, chatID uuid.UUID, cursor domain.MessageCursor) ([]domain.Message, error) {
+	query := `SELECT ` + messageColumns + `, ` + threadReplyCountColumn + ` FROM messenger.messages m
+			  WHERE m.chat_id = $1 AND m.thread_root_id IS NULL`
+	return r.selectPage(ctx, query, chatID, cursor)
+}
+
+func (r *MessageRepository) GetThreadReplies(ctx context.Context, rootID int64, cursor domain.MessageCursor) ([]domain.Message, error) {
+	query := `SELECT ` + messageColumns + ` FROM messenger.messages m WHERE m.thread_root_id = $1`
+	return r.selectPage(ctx, query, rootID, cursor)
+}
+
+// selectPage дополняет запрос с одним параметром ($1) условием keyset-курсора, порядком и лимитом
+func (r *MessageRepository) selectPage(ctx context.Context, query string, arg interface{}, cursor domain.MessageCursor) ([]domain.Message, error) {
+	var messages []domain.Message
+	var err error
+	switch {
+	case cursor.AfterID != nil:
+		query += ` AND m.id > $2 ORDER BY m.id ASC LIMIT $3`
+		err = r.db.SelectContext(ctx, &messages, query, arg, *cursor.AfterID, cursor.Limit)
+	case cursor.BeforeID != nil:
+		query += ` AND m.id < $2 ORDER BY m.id DESC LIMIT $3`
+		err = r.db.SelectContext(ctx, &messages, query, arg, *cursor.BeforeID, cursor.Limit)
+	default:
+		query += ` ORDER BY m.id DESC LIMIT $2`
+		err = r.db.SelectContext(ctx, &messages, query, arg, cursor.Limit)
+	}
+	return messages, err
+}
+
+func (r *MessageRepository) GetMessagesSince(ctx context.Context, userID uuid.UUID, sinceID int64, limit int) ([]domain.Message, error) {
+	var messages []domain.Message
+	query := `SELECT ` + messageColumns + ` FROM messenger.messages m
+			  JOIN messenger.chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = $1
+			  WHERE m.id > $2 AND m.thread_root_id IS NULL ORDER BY m.id ASC LIMIT $3`
+	err := r.db.SelectContext(ctx, &messages, query, userID, sinceID, limit)
+	return messages, err
+}
+
+func (r *MessageRepository) UpdateContent(ctx context.Context, msg *domain.Message, editorID uuid.UUID, content string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	historyQuery := `INSERT INTO messenger.message_edits (message_id, previous_content, edited_by)
+					 SELECT id, content, $2 FROM messenger.messages WHERE id = $1 AND deleted_at IS NULL`
+	if _, err := tx.ExecContext(ctx, historyQuery, msg.ID, editorID); err != nil {
+		return err
+	}
+
+	// search_vector пересчитывается триггером messages_search_vector_trigger
+	query := `UPDATE messenger.messages SET content = $1, edited_at = NOW()
+			  WHERE id = $2 AND deleted_at IS NULL RETURNING edited_at`
+	if err := tx.QueryRowxContext(ctx, query, content, msg.ID).Scan(&msg.EditedAt); err != nil {
+		return err
+	}
+	msg.Content = content
+
+	return tx.Commit()
+}
+
+func (r *MessageRepository) SoftDelete(ctx context.Context, msg *domain.Message) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// История правок остаётся для модерации; последний текст попадает в неё как ещё одна версия
+	historyQuery := `INSERT INTO messenger.message_edits (message_id, previous_content, edited_by)
+					 SELECT id, content, sender_id FROM messenger.messages WHERE id = $1 AND deleted_at IS NULL`
+	if _, err := tx.ExecContext(ctx, historyQuery, msg.ID); err != nil {
+		return err
+	}
+
+	// Пустой content обнуляет search_vector, и сообщение пропадает из поиска
+	query := `UPDATE messenger.messages SET content = '', deleted_at = NOW()
+			  WHERE id = $1 RETURNING deleted_at`
+	if err := tx.QueryRowxContext(ctx, query, msg.ID).Scan(&msg.DeletedAt); err != nil {
+		return err
+	}
+	msg.Content = ""
+
+	return tx.Commit()
+}
+
+func (r *MessageRepository) HardDelete(ctx context.Context, id int64) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// thread_root_id обнуляется при удалении корня (ON DELETE SET NULL), и без этого
+	// ответы треда оказались бы в ленте чата
+	if _, err := tx.ExecContext(ctx, `DELETE FROM messenger.messages WHERE thread_root_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM messenger.messages WHERE id = $1`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *MessageRepository) GetEdits(ctx context.Context, messageID int64) ([]domain.MessageEdit, error) {
+	var edits []domain.MessageEdit
+	query := `SELECT id, message_id, previous_content, edited_by, edited_at FROM messenger.message_edits
+			  WHERE message_id = $1 ORDER BY id DESC`
+	err := r.db.SelectContext(ctx, &edits, query, messageID)
+	return edits, err
 }
 
-func (r *MessageRepository) GetMessagesByChatID(ctx context.Context, chatID uuid.UUID, limit, offset int) ([]domain.Message, error) {
+func (r *MessageRepository) GetMentions(ctx context.Context, userID uuid.UUID, cursor domain.MessageCursor) ([]domain.Message, error) {
 	var messages []domain.Message
-	query := `SELECT id, chat_id, sender_id, content, created_at FROM messenger.messages 
-			  WHERE chat_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
-	err := r.db.SelectContext(ctx, &messages, query, chatID, limit, offset)
+	query := `SELECT ` + messageColumns + ` FROM messenger.mentions mn
+			  JOIN messenger.messages m ON m.id = mn.message_id
+			  JOIN messenger.chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = mn.user_id
+			  WHERE mn.user_id = $1 AND m.deleted_at IS NULL`
+	var err error
+	if cursor.BeforeID != nil {
+		query += ` AND m.id < $2 ORDER BY m.id DESC LIMIT $3`
+		err = r.db.SelectContext(ctx, &messages, query, userID, *cursor.BeforeID, cursor.Limit)
+	} else {
+		query += ` ORDER BY m.id DESC LIMIT $2`
+		err = r.db.SelectContext(ctx, &messages, query, userID, cursor.Limit)
+	}
 	return messages, err
 }
@@ -11,18 +11,19 @@ import (
 )
 
 type PushTokenRepository struct {
-	db *sqlx.DB
+	db *DB
 }
 
 func NewPushTokenRepository(db *sqlx.DB) *PushTokenRepository {
-	return &PushTokenRepository{db: db}
+	return &PushTokenRepository{db: instrument(db)}
 }
 
 func (r *PushTokenRepository) Create(ctx context.Context, token *domain.PushToken) error {
 	query := `
-		INSERT INTO system.push_tokens (id, user_id, token, device_info, created_at)
-		VALUES ($1, $2, $3, $4, NOW())
-		ON CONFLICT (token) DO UPDATE SET user_id = EXCLUDED.user_id, device_info = EXCLUDED.device_info
+		INSERT INTO system.push_tokens (id, user_id, token, device_info, session_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (token) DO UPDATE SET user_id = EXCLUDED.user_id, device_info = EXCLUDED.device_info,
+			session_id = EXCLUDED.session_id
 		RETURNING created_at
 	`
 	return r.db.QueryRowContext(ctx, query,
@@ -30,12 +31,13 @@ func (r *PushTokenRepository) Create(ctx context.Context, token *domain.PushToke
 		token.UserID,
 		token.Token,
 		token.DeviceInfo,
+		token.SessionID,
 	).Scan(&token.CreatedAt)
 }
 
 func (r *PushTokenRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.PushToken, error) {
 	var tokens []domain.PushToken
-	query := `SELECT id, user_id, token, device_info, created_at FROM system.push_tokens WHERE user_id = $1`
+	query := `SELECT id, user_id, token, device_info, session_id, created_at FROM system.push_tokens WHERE user_id = $1`
 	err := r.db.SelectContext(ctx, &tokens, query, userID)
 	if err != nil {
 		return nil, err
@@ -45,7 +47,7 @@ func (r *PushTokenRepository) GetByUserID(ctx context.Context, userID uuid.UUID)
 
 func (r *PushTokenRepository) GetByToken(ctx context.Context, token string) (*domain.PushToken, error) {
 	var pushToken domain.PushToken
-	query := `SELECT id, user_id, token, device_info, created_at FROM system.push_tokens WHERE token = $1`
+	query := `SELECT id, user_id, token, device_info, session_id, created_at FROM system.push_tokens WHERE token = $1`
 	err := r.db.GetContext(ctx, &pushToken, query, token)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -67,3 +69,9 @@ func (r *PushTokenRepository) DeleteByUserID(ctx context.Context, userID uuid.UU
 	_, err := r.db.ExecContext(ctx, query, userID)
 	return err
 }
+
+func (r *PushTokenRepository) DeleteBySessionID(ctx context.Context, sessionID uuid.UUID) error {
+	query := `DELETE FROM system.push_tokens WHERE session_id = $1`
+	_, err := r.db.ExecContext(ctx, query, sessionID)
+	return err
+}
@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/yourname/company-superapp/internal/domain"
+)
+
+type ReactionRepository struct {
+	db *DB
+}
+
+func NewReactionRepository(db *sqlx.DB) *ReactionRepository {
+	return &ReactionRepository{db: instrument(db)}
+}
+
+func (r *ReactionRepository) Add(ctx context.Context, messageID int64, userID uuid.UUID, emoji string) (bool, error) {
+	query := `INSERT INTO messenger.message_reactions (message_id, user_id, emoji) VALUES ($1, $2, $3)
+			  ON CONFLICT DO NOTHING`
+	result, err := r.db.ExecContext(ctx, query, messageID, userID, emoji)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *ReactionRepository) Remove(ctx context.Context, messageID int64, userID uuid.UUID, emoji string) (bool, error) {
+	query := `DELETE FROM messenger.message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3`
+	result, err := r.db.ExecContext(ctx, query, messageID, userID, emoji)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *ReactionRepository) GetSummaries(ctx context.Context, messageIDs []int64, userID uuid.UUID) (map[int64][]domain.ReactionSummary, error) {
+	summaries := make(map[int64][]domain.ReactionSummary)
+	if len(messageIDs) == 0 {
+		return summaries, nil
+	}
+
+	var rows []struct {
+		MessageID int64 `db:"message_id"`
+		domain.ReactionSummary
+	}
+	// Эмодзи упорядочены по первой реакции, чтобы порядок не прыгал при новых реакциях
+	query := `SELECT message_id, emoji, COUNT(*) AS count, BOOL_OR(user_id = $2) AS reacted_by_me
+			  FROM messenger.message_reactions
+			  WHERE message_id = ANY($1)
+			  GROUP BY message_id, emoji
+			  ORDER BY message_id, MIN(created_at), emoji`
+	if err := r.db.SelectContext(ctx, &rows, query, pq.Array(messageIDs), userID); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		summaries[row.MessageID] = append(summaries[row.MessageID], row.ReactionSummary)
+	}
+	return summaries, nil
+}
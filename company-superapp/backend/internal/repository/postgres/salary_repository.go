@@ -11,11 +11,11 @@ import (
 )
 
 type SalaryRepository struct {
-	db *sqlx.DB
+	db *DB
 }
 
 func NewSalaryRepository(db *sqlx.DB) *SalaryRepository {
-	return &SalaryRepository{db: db}
+	return &SalaryRepository{db: instrument(db)}
 }
 
 func (r *SalaryRepository) GetByUserID(ctx context.Context, userID uuid.UUID) (*domain.Salary, error) {
@@ -9,11 +9,11 @@ import (
 )
 
 type SearchRepository struct {
-	db *sqlx.DB
+	db *DB
 }
 
 func NewSearchRepository(db *sqlx.DB) *SearchRepository {
-	return &SearchRepository{db: db}
+	return &SearchRepository{db: instrument(db)}
 }
 
 type userSearchResult struct {
@@ -77,6 +77,7 @@ func (r *SearchRepository) SearchMessages(ctx context.Context, query string, lim
 			ts_rank(m.search_vector, plainto_tsquery('simple', $1)) as rank
 		FROM messenger.messages m
 		WHERE m.search_vector @@ plainto_tsquery('simple', $1)
+			AND m.deleted_at IS NULL
 		ORDER BY rank DESC
 		LIMIT $2
 	`
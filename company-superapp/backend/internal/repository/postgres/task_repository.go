@@ -11,24 +11,24 @@ import (
 )
 
 type TaskRepository struct {
-	db *sqlx.DB
+	db *DB
 }
 
 func NewTaskRepository(db *sqlx.DB) *TaskRepository {
-	return &TaskRepository{db: db}
+	return &TaskRepository{db: instrument(db)}
 }
 
 func (r *TaskRepository) Create(ctx context.Context, task *domain.Task) error {
-	query := `INSERT INTO tasks.tasks (title, description, status, creator_id, assignee_id, due_date, source_message_id)
-              VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, updated_at`
+	query := `INSERT INTO tasks.tasks (title, description, status, creator_id, assignee_id, due_date, source_message_id, source_thread_id)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at, updated_at`
 	return r.db.QueryRowxContext(ctx, query,
-		task.Title, task.Description, task.Status, task.CreatorID, task.AssigneeID, task.DueDate, task.SourceMessageID,
+		task.Title, task.Description, task.Status, task.CreatorID, task.AssigneeID, task.DueDate, task.SourceMessageID, task.SourceThreadID,
 	).Scan(&task.ID, &task.CreatedAt, &task.UpdatedAt)
 }
 
 func (r *TaskRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Task, error) {
 	var task domain.Task
-	query := `SELECT id, title, description, status, creator_id, assignee_id, due_date, source_message_id, created_at, updated_at
+	query := `SELECT id, title, description, status, creator_id, assignee_id, due_date, source_message_id, source_thread_id, created_at, updated_at
               FROM tasks.tasks WHERE id = $1`
 	err := r.db.GetContext(ctx, &task, query, id)
 	if err == sql.ErrNoRows {
@@ -39,7 +39,7 @@ func (r *TaskRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Tas
 
 func (r *TaskRepository) GetAll(ctx context.Context, assigneeID *uuid.UUID, status *domain.TaskStatus) ([]domain.Task, error) {
 	var tasks []domain.Task
-	query := `SELECT id, title, description, status, creator_id, assignee_id, due_date, source_message_id, created_at, updated_at
+	query := `SELECT id, title, description, status, creator_id, assignee_id, due_date, source_message_id, source_thread_id, created_at, updated_at
               FROM tasks.tasks WHERE 1=1`
 	args := []interface{}{}
 	argIndex := 1
@@ -62,7 +62,7 @@ func (r *TaskRepository) GetAll(ctx context.Context, assigneeID *uuid.UUID, stat
 
 func (r *TaskRepository) GetByDateRange(ctx context.Context, userID uuid.UUID, from, to time.Time) ([]domain.Task, error) {
 	var tasks []domain.Task
-	query := `SELECT id, title, description, status, creator_id, assignee_id, due_date, source_message_id, created_at, updated_at
+	query := `SELECT id, title, description, status, creator_id, assignee_id, due_date, source_message_id, source_thread_id, created_at, updated_at
               FROM tasks.tasks 
               WHERE (creator_id = $1 OR assignee_id = $1) 
               AND created_at >= $2 AND created_at <= $3
@@ -9,11 +9,11 @@ import (
 )
 
 type TaxiRequestRepository struct {
-	db *sqlx.DB
+	db *DB
 }
 
 func NewTaxiRequestRepository(db *sqlx.DB) *TaxiRequestRepository {
-	return &TaxiRequestRepository{db: db}
+	return &TaxiRequestRepository{db: instrument(db)}
 }
 
 func (r *TaxiRequestRepository) Create(ctx context.Context, request *domain.TaxiRequest) error {
@@ -4,22 +4,26 @@ import (
 	"context"
 	"database/sql"
 
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/yourname/company-superapp/internal/domain"
 )
 
 type UserRepository struct {
-	db *sqlx.DB
+	db *DB
 }
 
 func NewUserRepository(db *sqlx.DB) *UserRepository {
-	return &UserRepository{db: db}
+	return &UserRepository{db: instrument(db)}
 }
 
+const userColumns = `id, email, password_hash, full_name, role, created_at, email_verified_at`
+
 func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 	query := `INSERT INTO system.users (email, password_hash, full_name, role) 
               VALUES ($1, $2, $3, $4) RETURNING id, created_at`
-	
+
 	err := r.db.QueryRowxContext(ctx, query, user.Email, user.PasswordHash, user.FullName, user.Role).
 		Scan(&user.ID, &user.CreatedAt)
 
@@ -28,8 +32,8 @@ func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 
 func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
 	var user domain.User
-	query := `SELECT id, email, password_hash, full_name, role, created_at FROM system.users WHERE email=$1`
-	
+	query := `SELECT ` + userColumns + ` FROM system.users WHERE email=$1`
+
 	err := r.db.GetContext(ctx, &user, query, email)
 	if err == sql.ErrNoRows {
 		return nil, nil // Or a custom not found error
@@ -37,3 +41,41 @@ func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*domain
 
 	return &user, err
 }
+
+func (r *UserRepository) FindByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	var user domain.User
+	query := `SELECT ` + userColumns + ` FROM system.users WHERE id=$1`
+
+	err := r.db.GetContext(ctx, &user, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return &user, err
+}
+
+func (r *UserRepository) FindByIDs(ctx context.Context, ids []uuid.UUID) ([]domain.User, error) {
+	var users []domain.User
+	query := `SELECT ` + userColumns + ` FROM system.users WHERE id = ANY($1)`
+
+	err := r.db.SelectContext(ctx, &users, query, pq.Array(ids))
+	return users, err
+}
+
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE system.users SET email_verified_at = NOW() WHERE id = $1 AND email_verified_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *UserRepository) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	query := `UPDATE system.users SET password_hash = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, passwordHash, id)
+	return err
+}
+
+func (r *UserRepository) UpdateRole(ctx context.Context, id uuid.UUID, role string) error {
+	query := `UPDATE system.users SET role = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, role, id)
+	return err
+}
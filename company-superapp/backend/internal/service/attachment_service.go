@@ -0,0 +1,261 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/yourname/company-superapp/internal/domain"
+	"github.com/yourname/company-superapp/internal/pkg/s3"
+)
+
+var (
+	ErrStorageUnavailable    = errors.New("file storage is unavailable")
+	ErrAttachmentNotFound    = errors.New("attachment not found")
+	ErrAttachmentTooLarge    = errors.New("attachment is too large")
+	ErrAttachmentType        = errors.New("attachment type is not allowed")
+	ErrAttachmentNotUploaded = errors.New("attachment has not been uploaded yet")
+	ErrAttachmentMismatch    = errors.New("uploaded file does not match the declared size or type")
+)
+
+// maxAttachmentSize — максимальный размер одного вложения
+const maxAttachmentSize = 25 << 20
+
+var allowedAttachmentTypes = map[string]bool{
+	"image/jpeg":               true,
+	"image/png":                true,
+	"image/gif":                true,
+	"image/webp":               true,
+	"application/pdf":          true,
+	"text/plain":               true,
+	"text/csv":                 true,
+	"application/zip":          true,
+	"application/msword":       true,
+	"application/vnd.ms-excel": true,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+}
+
+// sniffLength — сколько первых байт файла нужно http.DetectContentType
+const sniffLength = 512
+
+// oleSignature — заголовок составного документа OLE: так начинаются .doc и .xls,
+// которые http.DetectContentType не распознаёт
+var oleSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// sniffedAttachmentTypes — какой тип определяется по содержимому файла заявленного типа, если не он сам:
+// документы Office Open XML — ZIP-архивы, CSV — обычный текст
+var sniffedAttachmentTypes = map[string][]string{
+	"text/csv":                 {"text/plain"},
+	"application/msword":       {"application/x-ole-storage"},
+	"application/vnd.ms-excel": {"application/x-ole-storage"},
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   {"application/zip"},
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         {"application/zip"},
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": {"application/zip"},
+}
+
+// AttachmentService выдаёт ссылки на загрузку и скачивание файлов чата.
+// Файлы лежат в MinIO под chats/<chatID>/, доступ к ним есть только у участников чата.
+type AttachmentService struct {
+	attachmentRepo domain.AttachmentRepository
+	chatRepo       domain.ChatRepository
+	minioClient    *s3.MinioClient
+}
+
+func NewAttachmentService(attachmentRepo domain.AttachmentRepository, chatRepo domain.ChatRepository, minioClient *s3.MinioClient) *AttachmentService {
+	return &AttachmentService{
+		attachmentRepo: attachmentRepo,
+		chatRepo:       chatRepo,
+		minioClient:    minioClient,
+	}
+}
+
+type CreateAttachmentInput struct {
+	FileName    string `json:"file_name" binding:"required,max=255"`
+	ContentType string `json:"content_type" binding:"required"`
+	Size        int64  `json:"size" binding:"required,min=1"`
+}
+
+// AttachmentUpload — созданное вложение и ссылка для PUT с заголовком Content-Type из запроса
+type AttachmentUpload struct {
+	Attachment *domain.Attachment `json:"attachment"`
+	UploadURL  string             `json:"upload_url"`
+}
+
+// CreateUpload регистрирует вложение и возвращает presigned URL для загрузки файла в MinIO
+func (s *AttachmentService) CreateUpload(ctx context.Context, userID, chatID uuid.UUID, input CreateAttachmentInput) (*AttachmentUpload, error) {
+	if s.minioClient == nil {
+		return nil, ErrStorageUnavailable
+	}
+	if err := s.requireMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+
+	contentType, err := normalizeContentType(input.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	if input.Size > maxAttachmentSize {
+		return nil, ErrAttachmentTooLarge
+	}
+
+	fileName := strings.TrimSpace(filepath.Base(input.FileName))
+	attachment := &domain.Attachment{
+		ID:          uuid.New(),
+		ChatID:      chatID,
+		UploaderID:  userID,
+		FileName:    fileName,
+		ContentType: contentType,
+		Size:        input.Size,
+		Status:      domain.AttachmentStatusPending,
+	}
+	attachment.ObjectKey = fmt.Sprintf("chats/%s/%s%s", chatID, attachment.ID, strings.ToLower(filepath.Ext(fileName)))
+
+	if err := s.attachmentRepo.Create(ctx, attachment); err != nil {
+		return nil, err
+	}
+
+	uploadURL, err := s.minioClient.GeneratePresignedUploadURLWithContentType(ctx, attachment.ObjectKey, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AttachmentUpload{Attachment: attachment, UploadURL: uploadURL}, nil
+}
+
+// ConfirmUpload проверяет, что файл действительно загружен и совпадает с заявленным размером и типом.
+// Тип определяется по первым байтам файла: Content-Type объекта задаёт сам загружающий.
+// Файл сначала копируется под постоянный ключ, на который не выдаётся ссылок на загрузку, и проверяется
+// уже копия: ссылка из CreateUpload ещё действует и позволила бы подменить проверенный файл.
+// Несовпадающий файл удаляется из MinIO.
+func (s *AttachmentService) ConfirmUpload(ctx context.Context, userID, chatID, attachmentID uuid.UUID) (*domain.Attachment, error) {
+	if s.minioClient == nil {
+		return nil, ErrStorageUnavailable
+	}
+	attachment, err := s.getChatAttachment(ctx, chatID, attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	if attachment.UploaderID != userID {
+		return nil, ErrAttachmentNotFound
+	}
+	if attachment.Status == domain.AttachmentStatusUploaded {
+		return attachment, nil
+	}
+
+	uploadKey := attachment.ObjectKey
+	objectKey := fmt.Sprintf("chats/%s/files/%s%s", chatID, attachment.ID, filepath.Ext(uploadKey))
+	err = s.minioClient.CopyObject(ctx, uploadKey, objectKey)
+	if errors.Is(err, s3.ErrObjectNotFound) {
+		return nil, ErrAttachmentNotUploaded
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.minioClient.DeleteObject(ctx, uploadKey); err != nil {
+		return nil, err
+	}
+
+	matches, err := s.verifyObject(ctx, objectKey, attachment)
+	if err != nil {
+		return nil, err
+	}
+	if !matches {
+		if err := s.minioClient.DeleteObject(ctx, objectKey); err != nil {
+			return nil, err
+		}
+		return nil, ErrAttachmentMismatch
+	}
+
+	attachment.ObjectKey = objectKey
+	if err := s.attachmentRepo.MarkUploaded(ctx, attachment); err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// verifyObject сверяет размер и тип загруженного объекта с заявленными при создании вложения
+func (s *AttachmentService) verifyObject(ctx context.Context, objectKey string, attachment *domain.Attachment) (bool, error) {
+	info, err := s.minioClient.StatObject(ctx, objectKey)
+	if err != nil {
+		return false, err
+	}
+	if info.Size != attachment.Size || info.Size > maxAttachmentSize {
+		return false, nil
+	}
+	head, err := s.minioClient.ReadObjectHead(ctx, objectKey, sniffLength)
+	if err != nil {
+		return false, err
+	}
+	return contentMatches(head, attachment.ContentType), nil
+}
+
+// GetDownloadURL возвращает presigned URL на скачивание; до отправки сообщения файл доступен только загрузившему
+func (s *AttachmentService) GetDownloadURL(ctx context.Context, userID, chatID, attachmentID uuid.UUID) (string, error) {
+	if s.minioClient == nil {
+		return "", ErrStorageUnavailable
+	}
+	if err := s.requireMember(ctx, chatID, userID); err != nil {
+		return "", err
+	}
+	attachment, err := s.getChatAttachment(ctx, chatID, attachmentID)
+	if err != nil {
+		return "", err
+	}
+	if attachment.Status != domain.AttachmentStatusUploaded {
+		return "", ErrAttachmentNotUploaded
+	}
+	if attachment.MessageID == nil && attachment.UploaderID != userID {
+		return "", ErrAttachmentNotFound
+	}
+
+	return s.minioClient.GeneratePresignedDownloadURLAs(ctx, attachment.ObjectKey, attachment.FileName)
+}
+
+func (s *AttachmentService) getChatAttachment(ctx context.Context, chatID, attachmentID uuid.UUID) (*domain.Attachment, error) {
+	attachment, err := s.attachmentRepo.GetByID(ctx, attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	if attachment == nil || attachment.ChatID != chatID {
+		return nil, ErrAttachmentNotFound
+	}
+	return attachment, nil
+}
+
+func (s *AttachmentService) requireMember(ctx context.Context, chatID, userID uuid.UUID) error {
+	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrNotChatMember
+	}
+	return nil
+}
+
+// normalizeContentType отбрасывает параметры (charset и т.п.) и проверяет тип по белому списку
+func normalizeContentType(contentType string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !allowedAttachmentTypes[mediaType] {
+		return "", ErrAttachmentType
+	}
+	return mediaType, nil
+}
+
+// contentMatches сверяет тип, определённый по первым байтам файла, с заявленным при создании вложения
+func contentMatches(head []byte, declared string) bool {
+	sniffed := "application/x-ole-storage"
+	if !bytes.HasPrefix(head, oleSignature) {
+		sniffed, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	}
+	return sniffed == declared || slices.Contains(sniffedAttachmentTypes[declared], sniffed)
+}
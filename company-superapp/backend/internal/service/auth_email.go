@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/company-superapp/internal/domain"
+	"github.com/yourname/company-superapp/internal/pkg/mailer"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidEmailToken = errors.New("invalid or expired link")
+	ErrEmailNotVerified  = errors.New("email is not verified")
+)
+
+const (
+	// purposeVerifyEmail и purposeResetPassword — claim aud одноразовых токенов из писем
+	purposeVerifyEmail   = "verify_email"
+	purposeResetPassword = "reset_password"
+
+	emailVerificationTTL = 24 * time.Hour
+	passwordResetTTL     = time.Hour
+
+	// emailTokenPrefix — jti последнего выданного токена: email_token:<назначение>:<user_id>.
+	// Новый токен заменяет прежний, использованный удаляется
+	emailTokenPrefix = "email_token:"
+
+	// emailSendTimeout — письма отправляются в фоне, уже после ответа клиенту
+	emailSendTimeout = 30 * time.Second
+)
+
+// consumeEmailTokenScript гасит токен, только если предъявлен последний выданный
+var consumeEmailTokenScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+type EmailInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type VerifyEmailInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// ResendVerification повторно отправляет письмо подтверждения. Ответ не зависит от того,
+// зарегистрирован ли адрес, поэтому для неизвестного или уже подтверждённого email ничего не происходит
+func (s *AuthService) ResendVerification(ctx context.Context, email string) error {
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil || user == nil || user.EmailVerifiedAt != nil {
+		return err
+	}
+	return s.sendVerificationEmail(ctx, user)
+}
+
+// VerifyEmail подтверждает email по токену из письма
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	userID, err := s.consumeEmailToken(ctx, token, purposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+	return s.userRepo.MarkEmailVerified(ctx, userID)
+}
+
+// ForgotPassword отправляет ссылку для сброса пароля; как и ResendVerification, не раскрывает,
+// есть ли пользователь с таким email
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil || user == nil {
+		return err
+	}
+
+	token, err := s.issueEmailToken(ctx, user.ID, purposeResetPassword, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	s.sendEmail(mailer.Message{
+		To:      user.Email,
+		Subject: "Сброс пароля",
+		Body: fmt.Sprintf("Здравствуйте!\n\nЧтобы задать новый пароль, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действует %d мин. и может быть использована один раз. "+
+			"Если вы не запрашивали сброс пароля, просто проигнорируйте это письмо.\n",
+			s.emailLink("/reset-password", token), int(passwordResetTTL.Minutes())),
+	})
+	return nil
+}
+
+// ResetPassword задаёт новый пароль по токену из письма и завершает все сессии пользователя:
+// если пароль был скомпрометирован, злоумышленник теряет доступ на всех устройствах
+func (s *AuthService) ResetPassword(ctx context.Context, input ResetPasswordInput) error {
+	userID, err := s.consumeEmailToken(ctx, input.Token, purposeResetPassword)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePassword(ctx, userID, string(hashedPassword)); err != nil {
+		return err
+	}
+	// Письмо со ссылкой пришло на этот адрес — значит, он подтверждён
+	if err := s.userRepo.MarkEmailVerified(ctx, userID); err != nil {
+		return err
+	}
+	return s.revokeAllSessions(ctx, userID)
+}
+
+// sendVerificationEmail выпускает токен подтверждения и отправляет письмо со ссылкой
+func (s *AuthService) sendVerificationEmail(ctx context.Context, user *domain.User) error {
+	token, err := s.issueEmailToken(ctx, user.ID, purposeVerifyEmail, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	s.sendEmail(mailer.Message{
+		To:      user.Email,
+		Subject: "Подтверждение email",
+		Body: fmt.Sprintf("Здравствуйте!\n\nЧтобы подтвердить адрес и войти в Company SuperApp, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действует %d ч. Если вы не регистрировались, просто проигнорируйте это письмо.\n",
+			s.emailLink("/verify-email", token), int(emailVerificationTTL.Hours())),
+	})
+	return nil
+}
+
+// issueEmailToken подписывает одноразовый токен назначения purpose; в Redis хранится только его jti
+func (s *AuthService) issueEmailToken(ctx context.Context, userID uuid.UUID, purpose string, ttl time.Duration) (string, error) {
+	jti := uuid.NewString()
+	if err := s.redis.Set(ctx, emailTokenKey(purpose, userID), jti, ttl).Err(); err != nil {
+		return "", err
+	}
+	return s.tokens.Sign(jwt.MapClaims{
+		"sub": userID.String(),
+		"aud": purpose,
+		"jti": jti,
+		"exp": time.Now().Add(ttl).Unix(),
+	})
+}
+
+// consumeEmailToken проверяет подпись и срок токена и гасит его, возвращая пользователя
+func (s *AuthService) consumeEmailToken(ctx context.Context, token, purpose string) (uuid.UUID, error) {
+	claims, err := s.tokens.VerifyAudience(token, purpose)
+	if err != nil {
+		return uuid.Nil, ErrInvalidEmailToken
+	}
+	sub, _ := claims["sub"].(string)
+	jti, _ := claims["jti"].(string)
+	userID, err := uuid.Parse(sub)
+	if err != nil || jti == "" {
+		return uuid.Nil, ErrInvalidEmailToken
+	}
+
+	consumed, err := consumeEmailTokenScript.Run(ctx, s.redis, []string{emailTokenKey(purpose, userID)}, jti).Int()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if consumed == 0 {
+		return uuid.Nil, ErrInvalidEmailToken
+	}
+	return userID, nil
+}
+
+func (s *AuthService) emailLink(path, token string) string {
+	return s.appURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendEmail отправляет письмо в фоне: время ответа не должно зависеть от почтового сервера
+// и выдавать, существует ли адрес
+func (s *AuthService) sendEmail(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), emailSendTimeout)
+		defer cancel()
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			log.Printf("error sending email to %s: %v", msg.To, err)
+		}
+	}()
+}
+
+// revokeAllSessions завершает все сессии пользователя
+func (s *AuthService) revokeAllSessions(ctx context.Context, userID uuid.UUID) error {
+	ids, err := s.redis.SMembers(ctx, userSessionsPrefix+userID.String()).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		sessionID, err := uuid.Parse(id)
+		if err != nil {
+			continue
+		}
+		if _, err := s.revokeSession(ctx, userID, sessionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func emailTokenKey(purpose string, userID uuid.UUID) string {
+	return emailTokenPrefix + purpose + ":" + userID.String()
+}
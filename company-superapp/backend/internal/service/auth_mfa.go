@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/yourname/company-superapp/internal/domain"
+)
+
+var (
+	ErrInvalidMFAChallenge   = errors.New("invalid or expired MFA challenge, please log in again")
+	ErrMFAEnrollmentRequired = errors.New("two-factor authentication must be set up, please log in again")
+)
+
+const (
+	// purposeMFAChallenge — claim aud токена, который выдаётся после пароля вместо AuthTokens
+	purposeMFAChallenge = "mfa_challenge"
+	mfaChallengeTTL     = 5 * time.Minute
+	// mfaChallengeMaxAttempts — после стольких неверных кодов нужно снова ввести пароль
+	mfaChallengeMaxAttempts = 5
+	// mfaChallengePrefix — незавершённый вход: HASH с user_id, device_name и числом попыток
+	mfaChallengePrefix = "mfa_challenge:"
+)
+
+// MFAChallenge — ответ Login, когда для входа нужен второй фактор
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	// EnrollmentRequired — роль требует MFA, но он ещё не настроен: клиент получает секрет
+	// через /auth/mfa/enroll и подтверждает его первым кодом в /auth/mfa/verify
+	EnrollmentRequired bool `json:"enrollment_required"`
+	// ExpiresIn — время жизни mfa_token в секундах
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+type MFATokenInput struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+type MFAVerifyInput struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	// Code — TOTP-код или код восстановления
+	Code string `json:"code" binding:"required"`
+}
+
+// MFALoginResult — токены после второго фактора
+type MFALoginResult struct {
+	AuthTokens
+	// RecoveryCodes заполнены, только если MFA был включён при этом входе
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// mfaChallenge — незавершённый вход, сохранённый в Redis
+type mfaChallenge struct {
+	key        string
+	userID     uuid.UUID
+	deviceName string
+}
+
+// EnrollMFA начинает обязательную настройку MFA при входе, до выдачи токенов
+func (s *AuthService) EnrollMFA(ctx context.Context, mfaToken string) (*MFASetup, error) {
+	challenge, err := s.loadMFAChallenge(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.mfa.Setup(ctx, challenge.userID)
+}
+
+// VerifyMFA завершает вход вторым фактором. Если MFA ещё не был включён (обязательная настройка),
+// код подтверждает новый секрет и в ответе возвращаются коды восстановления
+func (s *AuthService) VerifyMFA(ctx context.Context, input MFAVerifyInput, client SessionClient) (*MFALoginResult, error) {
+	challenge, err := s.loadMFAChallenge(ctx, input.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts, err := s.redis.HIncrBy(ctx, challenge.key, "attempts", 1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if attempts > mfaChallengeMaxAttempts {
+		s.redis.Del(ctx, challenge.key)
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	user, err := s.userRepo.FindByID(ctx, challenge.userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	enabled, err := s.mfa.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	var recoveryCodes []string
+	if enabled {
+		err = s.mfa.Verify(ctx, user.ID, input.Code)
+	} else {
+		recoveryCodes, err = s.mfa.Enable(ctx, user.ID, input.Code)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Челлендж одноразовый: параллельный запрос с тем же токеном не получит вторую сессию
+	deleted, err := s.redis.Del(ctx, challenge.key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	tokens, err := s.startSession(ctx, user, challenge.deviceName, client)
+	if err != nil {
+		return nil, err
+	}
+	return &MFALoginResult{AuthTokens: *tokens, RecoveryCodes: recoveryCodes}, nil
+}
+
+// requiresMFA сообщает, нужен ли пользователю второй фактор и включён ли он
+func (s *AuthService) requiresMFA(ctx context.Context, user *domain.User) (required, enabled bool, err error) {
+	enabled, err = s.mfa.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return false, false, err
+	}
+	return enabled || s.mfa.Required(user.Role), enabled, nil
+}
+
+// startMFAChallenge запоминает вход с верным паролем и выдаёт токен для второго шага
+func (s *AuthService) startMFAChallenge(ctx context.Context, user *domain.User, deviceName string, enrollment bool) (*MFAChallenge, error) {
+	jti := uuid.NewString()
+	key := mfaChallengePrefix + jti
+	pipe := s.redis.TxPipeline()
+	pipe.HSet(ctx, key, "user_id", user.ID.String(), "device_name", deviceName, "attempts", 0)
+	pipe.Expire(ctx, key, mfaChallengeTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	token, err := s.tokens.Sign(jwt.MapClaims{
+		"sub": user.ID.String(),
+		"aud": purposeMFAChallenge,
+		"jti": jti,
+		"exp": time.Now().Add(mfaChallengeTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFAChallenge{
+		MFARequired:        true,
+		MFAToken:           token,
+		EnrollmentRequired: enrollment,
+		ExpiresIn:          int64(mfaChallengeTTL.Seconds()),
+	}, nil
+}
+
+func (s *AuthService) loadMFAChallenge(ctx context.Context, mfaToken string) (*mfaChallenge, error) {
+	claims, err := s.tokens.VerifyAudience(mfaToken, purposeMFAChallenge)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	jti, _ := claims["jti"].(string)
+	sub, _ := claims["sub"].(string)
+	if jti == "" {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	key := mfaChallengePrefix + jti
+	fields, err := s.redis.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 || fields["user_id"] != sub {
+		return nil, ErrInvalidMFAChallenge
+	}
+	userID, err := uuid.Parse(sub)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	return &mfaChallenge{key: key, userID: userID, deviceName: fields["device_name"]}, nil
+}
@@ -2,32 +2,99 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"github.com/yourname/company-superapp/internal/domain"
+	"github.com/yourname/company-superapp/internal/pkg/authtoken"
+	"github.com/yourname/company-superapp/internal/pkg/mailer"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound       = errors.New("user not found")
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidWSTicket    = errors.New("invalid or expired websocket ticket")
+	ErrInvalidRefresh     = errors.New("invalid or expired refresh token")
+	ErrRefreshReused      = errors.New("refresh token has already been used, please log in again")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrNoSession          = errors.New("access token is not bound to a session")
 )
 
+// wsTicketTTL — время жизни одноразового тикета для подключения к WebSocket
+const wsTicketTTL = 30 * time.Second
+
+const (
+	// refreshTokenPrefix — запись refresh token по его SHA-256; хранится до истечения и после ротации,
+	// чтобы повторное предъявление старого токена было распознано
+	refreshTokenPrefix = "refresh_token:"
+	// refreshFamilyPrefix — семейство токенов одного входа (сессия): HASH с user_id, хешем текущего
+	// токена и данными устройства; ID семейства — claim sid в access token
+	refreshFamilyPrefix = "refresh_family:"
+	// userSessionsPrefix — SET ID сессий пользователя
+	userSessionsPrefix = "user_sessions:"
+	// revokedSessionPrefix — отозванные сессии; запись живёт, пока могут быть действительны их access token
+	revokedSessionPrefix = "revoked_session:"
+)
+
+// rotateRefreshScript заменяет текущий токен семейства, только если предъявлен именно он
+var rotateRefreshScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'current') ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'current', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// SessionRevocationNotifier закрывает открытые WebSocket-соединения отозванной сессии
+type SessionRevocationNotifier interface {
+	NotifySessionRevoked(userID, sessionID uuid.UUID)
+}
+
 type AuthService struct {
-	userRepo domain.UserRepository
-	redis    *redis.Client
-	jwtSecret []byte
+	userRepo      domain.UserRepository
+	pushTokenRepo domain.PushTokenRepository
+	redis         *redis.Client
+	tokens        *authtoken.Manager
+	mailer        mailer.Mailer
+	mfa           *MFAService
+	loginGuard    *LoginGuard
+	// sso — вход через корпоративный IdP; nil, если OIDC не настроен
+	sso        *SSO
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	// appURL — адрес клиентского приложения для ссылок в письмах
+	appURL string
+	// sessionNotifier — WebSocket Hub; nil, пока не подключён через SetSessionNotifier
+	sessionNotifier SessionRevocationNotifier
 }
 
-func NewAuthService(userRepo domain.UserRepository, redisClient *redis.Client, secret string) *AuthService {
+func NewAuthService(userRepo domain.UserRepository, pushTokenRepo domain.PushTokenRepository, redisClient *redis.Client, tokens *authtoken.Manager, mail mailer.Mailer, mfa *MFAService, loginGuard *LoginGuard, sso *SSO, appURL string, accessTTL, refreshTTL time.Duration) *AuthService {
 	return &AuthService{
-		userRepo: userRepo,
-		redis:    redisClient,
-		jwtSecret: []byte(secret),
+		userRepo:      userRepo,
+		pushTokenRepo: pushTokenRepo,
+		redis:         redisClient,
+		tokens:        tokens,
+		mailer:        mail,
+		mfa:           mfa,
+		loginGuard:    loginGuard,
+		sso:           sso,
+		appURL:        strings.TrimRight(appURL, "/"),
+		accessTTL:     accessTTL,
+		refreshTTL:    refreshTTL,
 	}
 }
 
@@ -55,66 +122,440 @@ func (s *AuthService) Register(ctx context.Context, input RegisterInput) (*domai
 		return nil, err
 	}
 
+	// Аккаунт создан; если письмо не ушло, пользователь запросит его повторно
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		log.Printf("error sending verification email to user %s: %v", user.ID, err)
+	}
+
 	return user, nil
 }
 
 type LoginInput struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
+	// DeviceName — название устройства для списка сессий, например «iPhone Анны»
+	DeviceName string `json:"device_name" binding:"max=100"`
+}
+
+// SessionClient — откуда пришёл запрос входа или обновления токена
+type SessionClient struct {
+	UserAgent string
+	IP        string
 }
 
 type AuthTokens struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn — время жизни access token в секундах
+	ExpiresIn int64 `json:"expires_in"`
 }
 
-func (s *AuthService) Login(ctx context.Context, input LoginInput) (*AuthTokens, error) {
+// dummyPasswordHash — bcrypt-хеш с той же стоимостью, что и у настоящих паролей
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), bcrypt.DefaultCost)
+	return hash
+})
+
+// Login проверяет пароль и выдаёт токены. Если пользователю нужен второй фактор,
+// вместо токенов возвращается MFAChallenge, а вход завершается через VerifyMFA
+func (s *AuthService) Login(ctx context.Context, input LoginInput, client SessionClient) (*AuthTokens, *MFAChallenge, error) {
+	if err := s.loginGuard.Check(ctx, input.Email, client.IP); err != nil {
+		return nil, nil, err
+	}
+
 	user, err := s.userRepo.FindByEmail(ctx, input.Email)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	if user == nil {
-		return nil, ErrUserNotFound
+
+	// Для неизвестного email и пользователя без пароля (вход только через IdP) пароль сверяется
+	// с фиктивным хешем: ответ занимает столько же времени и совпадает с ответом на неверный пароль,
+	// поэтому не выдаёт, зарегистрирован ли адрес и как пользователь входит
+	hasPassword := user != nil && user.PasswordHash != ""
+	passwordHash := dummyPasswordHash()
+	if hasPassword {
+		passwordHash = []byte(user.PasswordHash)
+	}
+	if err := bcrypt.CompareHashAndPassword(passwordHash, []byte(input.Password)); err != nil || !hasPassword {
+		if lockedFor, err := s.loginGuard.RecordFailure(ctx, input.Email); err != nil {
+			log.Printf("error recording failed login: %v", err)
+		} else if lockedFor > 0 {
+			log.Printf("login locked for %s after repeated failures", lockedFor)
+		}
+		return nil, nil, ErrInvalidCredentials
+	}
+	if err := s.loginGuard.RecordSuccess(ctx, input.Email); err != nil {
+		log.Printf("error resetting failed logins for user %s: %v", user.ID, err)
+	}
+	// Проверяется после пароля, чтобы не раскрывать статус чужих адресов
+	if user.EmailVerifiedAt == nil {
+		return nil, nil, ErrEmailNotVerified
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password))
+	required, enabled, err := s.requiresMFA(ctx, user)
 	if err != nil {
-		return nil, ErrInvalidCredentials
+		return nil, nil, err
+	}
+	if required {
+		challenge, err := s.startMFAChallenge(ctx, user, input.DeviceName, !enabled)
+		return nil, challenge, err
 	}
 
-	return s.generateAndStoreTokens(ctx, user.ID, user.Role)
+	tokens, err := s.startSession(ctx, user, input.DeviceName, client)
+	return tokens, nil, err
 }
 
-func (s *AuthService) generateAndStoreTokens(ctx context.Context, userID uuid.UUID, role string) (*AuthTokens, error) {
-	// Generate Access Token (with role claim)
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":  userID.String(),
-		"role": role,
-		"exp":  time.Now().Add(15 * time.Minute).Unix(),
-	})
-	accessTokenString, err := accessToken.SignedString(s.jwtSecret)
+// startSession открывает новое семейство refresh token и выдаёт первую пару токенов
+func (s *AuthService) startSession(ctx context.Context, user *domain.User, deviceName string, client SessionClient) (*AuthTokens, error) {
+	familyID := uuid.New()
+	refreshToken, refreshHash, err := newRefreshToken()
 	if err != nil {
 		return nil, err
 	}
 
-	// Generate Refresh Token
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": userID.String(),
-		"exp": time.Now().Add(7 * 24 * time.Hour).Unix(),
-	})
-	refreshTokenString, err := refreshToken.SignedString(s.jwtSecret)
+	familyKey := refreshFamilyPrefix + familyID.String()
+	now := time.Now().UTC().Format(time.RFC3339)
+	pipe := s.redis.TxPipeline()
+	pipe.HSet(ctx, familyKey,
+		"user_id", user.ID.String(),
+		"current", refreshHash,
+		"device_name", deviceName,
+		"user_agent", client.UserAgent,
+		"ip", client.IP,
+		"created_at", now,
+		"last_used_at", now,
+	)
+	pipe.Expire(ctx, familyKey, s.refreshTTL)
+	pipe.SAdd(ctx, userSessionsPrefix+user.ID.String(), familyID.String())
+	pipe.Expire(ctx, userSessionsPrefix+user.ID.String(), s.refreshTTL)
+	s.storeRefreshToken(ctx, pipe, refreshHash, refreshRecord{UserID: user.ID, FamilyID: familyID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, familyID, refreshToken)
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// refreshRecord — данные refresh token в Redis
+type refreshRecord struct {
+	UserID   uuid.UUID `json:"user_id"`
+	FamilyID uuid.UUID `json:"family_id"`
+}
+
+// Refresh обменивает refresh token на новую пару токенов. Каждый refresh token одноразовый:
+// предъявление уже заменённого токена означает его утечку, и всё семейство отзывается.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string, client SessionClient) (*AuthTokens, error) {
+	oldHash := hashRefreshToken(refreshToken)
+	payload, err := s.redis.Get(ctx, refreshTokenPrefix+oldHash).Bytes()
+	if err == redis.Nil {
+		return nil, ErrInvalidRefresh
+	}
+	if err != nil {
+		return nil, err
+	}
+	var record refreshRecord
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(ctx, record.UserID)
 	if err != nil {
 		return nil, err
 	}
+	if user == nil {
+		return nil, ErrInvalidRefresh
+	}
+	// Сессии, открытые до включения политики или до повышения роли, не продлеваются без MFA
+	required, enabled, err := s.requiresMFA(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if required && !enabled {
+		if _, err := s.revokeSession(ctx, record.UserID, record.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrMFAEnrollmentRequired
+	}
 
-	// Store Refresh Token in Redis
-	err = s.redis.Set(ctx, refreshTokenString, userID.String(), 7*24*time.Hour).Err()
+	newToken, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	familyKey := refreshFamilyPrefix + record.FamilyID.String()
+	rotated, err := rotateRefreshScript.Run(ctx, s.redis, []string{familyKey}, oldHash, newHash, s.refreshTTL.Milliseconds()).Int()
+	if err != nil {
+		return nil, err
+	}
+	if rotated == 0 {
+		// Семейство уже отозвано (HGET вернул nil) или токен был заменён раньше — повторное использование
+		revoked, err := s.revokeSession(ctx, record.UserID, record.FamilyID)
+		if err != nil {
+			return nil, err
+		}
+		if !revoked {
+			return nil, ErrInvalidRefresh
+		}
+		return nil, ErrRefreshReused
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.HSet(ctx, familyKey, "last_used_at", time.Now().UTC().Format(time.RFC3339), "ip", client.IP, "user_agent", client.UserAgent)
+	pipe.Expire(ctx, userSessionsPrefix+record.UserID.String(), s.refreshTTL)
+	s.storeRefreshToken(ctx, pipe, newHash, record)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, record.FamilyID, newToken)
+}
+
+func (s *AuthService) storeRefreshToken(ctx context.Context, pipe redis.Pipeliner, hash string, record refreshRecord) {
+	payload, _ := json.Marshal(record)
+	pipe.Set(ctx, refreshTokenPrefix+hash, payload, s.refreshTTL)
+}
+
+// issueTokens подписывает access token сессии sessionID и дополняет им refresh token
+func (s *AuthService) issueTokens(user *domain.User, sessionID uuid.UUID, refreshToken string) (*AuthTokens, error) {
+	accessTokenString, err := s.tokens.Sign(jwt.MapClaims{
+		"sub":  user.ID.String(),
+		"role": user.Role,
+		"sid":  sessionID.String(),
+		"exp":  time.Now().Add(s.accessTTL).Unix(),
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	return &AuthTokens{
 		AccessToken:  accessTokenString,
-		RefreshToken: refreshTokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.accessTTL.Seconds()),
 	}, nil
 }
+
+// JWKS возвращает публичные ключи, которыми клиенты и другие сервисы проверяют access token
+func (s *AuthService) JWKS() authtoken.JWKSet {
+	return s.tokens.JWKS()
+}
+
+// Session — вход пользователя с одного устройства
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	DeviceName string    `json:"device_name,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	// Current — сессия, которой принадлежит access token запроса
+	Current bool `json:"current"`
+}
+
+// ListSessions возвращает активные сессии пользователя, начиная с последней использованной
+func (s *AuthService) ListSessions(ctx context.Context, userID uuid.UUID, currentID string) ([]Session, error) {
+	setKey := userSessionsPrefix + userID.String()
+	ids, err := s.redis.SMembers(ctx, setKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.redis.Pipeline()
+	results := make([]*redis.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		results[i] = pipe.HGetAll(ctx, refreshFamilyPrefix+id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(ids))
+	var expired []interface{}
+	for i, id := range ids {
+		fields := results[i].Val()
+		sessionID, err := uuid.Parse(id)
+		if err != nil || len(fields) == 0 {
+			// Семейство истекло по TTL
+			expired = append(expired, id)
+			continue
+		}
+		session := Session{
+			ID:         sessionID,
+			DeviceName: fields["device_name"],
+			UserAgent:  fields["user_agent"],
+			IP:         fields["ip"],
+			Current:    id == currentID,
+		}
+		session.CreatedAt, _ = time.Parse(time.RFC3339, fields["created_at"])
+		session.LastUsedAt, _ = time.Parse(time.RFC3339, fields["last_used_at"])
+		sessions = append(sessions, session)
+	}
+	if len(expired) > 0 {
+		s.redis.SRem(ctx, setKey, expired...)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+// SetSessionNotifier подключает WebSocket Hub: он создаётся после сервисов, поэтому не передаётся в конструктор.
+// Вызывается при старте, до обработки запросов.
+func (s *AuthService) SetSessionNotifier(notifier SessionRevocationNotifier) {
+	s.sessionNotifier = notifier
+}
+
+// Logout завершает сессию, которой принадлежит access token
+func (s *AuthService) Logout(ctx context.Context, userID uuid.UUID, sessionID string) error {
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		return ErrNoSession
+	}
+	_, err = s.revokeSession(ctx, userID, id)
+	return err
+}
+
+// RevokeSession завершает сессию пользователя на другом устройстве
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	revoked, err := s.revokeSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// UnlockLogin снимает блокировку входа пользователя после серии неверных паролей
+func (s *AuthService) UnlockLogin(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	return s.loginGuard.Unlock(ctx, user.Email)
+}
+
+// IsSessionRevoked проверяет, отозвана ли сессия access token; вызывается AuthMiddleware на каждый запрос
+func (s *AuthService) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	n, err := s.redis.Exists(ctx, revokedSessionPrefix+sessionID).Result()
+	return n > 0, err
+}
+
+// revokeSession удаляет семейство refresh token, запрещает access token сессии до их истечения,
+// закрывает её WebSocket-соединения и удаляет push-токен устройства.
+// false — сессии у пользователя нет (или она уже завершена).
+func (s *AuthService) revokeSession(ctx context.Context, userID, sessionID uuid.UUID) (bool, error) {
+	familyKey := refreshFamilyPrefix + sessionID.String()
+	owner, err := s.redis.HGet(ctx, familyKey, "user_id").Result()
+	if err == redis.Nil || (err == nil && owner != userID.String()) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, familyKey)
+	pipe.SRem(ctx, userSessionsPrefix+userID.String(), sessionID.String())
+	pipe.Set(ctx, revokedSessionPrefix+sessionID.String(), 1, s.accessTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	if s.sessionNotifier != nil {
+		s.sessionNotifier.NotifySessionRevoked(userID, sessionID)
+	}
+
+	if err := s.pushTokenRepo.DeleteBySessionID(ctx, sessionID); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// newRefreshToken возвращает случайный непрозрачный токен и его хеш для хранения в Redis
+func newRefreshToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// WSTicket описывает одноразовый тикет для WebSocket-рукопожатия
+type WSTicket struct {
+	Ticket    string    `json:"ticket"`
+	UserID    uuid.UUID `json:"user_id"`
+	Role      string    `json:"role"`
+	SessionID string    `json:"session_id,omitempty"` // сессия этого access token; пусто для токенов без sid
+	ExpiresAt time.Time `json:"expires_at"`           // срок действия access token, которым был получен тикет
+}
+
+// IssueWSTicket выпускает короткоживущий одноразовый тикет для подключения к WebSocket.
+// Браузеры не позволяют передать заголовок Authorization при открытии сокета, поэтому
+// клиент сначала получает тикет по REST с обычным access token.
+func (s *AuthService) IssueWSTicket(ctx context.Context, userID uuid.UUID, role, sessionID string, tokenExpiresAt time.Time) (*WSTicket, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+
+	ticket := &WSTicket{
+		Ticket:    base64.RawURLEncoding.EncodeToString(raw),
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
+		ExpiresAt: tokenExpiresAt,
+	}
+
+	payload, err := json.Marshal(ticket)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.redis.Set(ctx, "ws_ticket:"+ticket.Ticket, payload, wsTicketTTL).Err(); err != nil {
+		return nil, err
+	}
+
+	return ticket, nil
+}
+
+// RedeemWSTicket атомарно забирает тикет из Redis, повторное использование невозможно.
+// Тикет отозванной после его выдачи сессии недействителен.
+func (s *AuthService) RedeemWSTicket(ctx context.Context, ticket string) (*WSTicket, error) {
+	payload, err := s.redis.GetDel(ctx, "ws_ticket:"+ticket).Bytes()
+	if err == redis.Nil {
+		return nil, ErrInvalidWSTicket
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result WSTicket
+	if err := json.Unmarshal(payload, &result); err != nil {
+		return nil, err
+	}
+	if !result.ExpiresAt.IsZero() && time.Now().After(result.ExpiresAt) {
+		return nil, ErrInvalidWSTicket
+	}
+	if result.SessionID != "" {
+		revoked, err := s.IsSessionRevoked(ctx, result.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrInvalidWSTicket
+		}
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/yourname/company-superapp/internal/domain"
+	"github.com/yourname/company-superapp/internal/pkg/oidc"
+)
+
+var (
+	ErrSSONotConfigured    = errors.New("single sign-on is not configured")
+	ErrInvalidSSOState     = errors.New("invalid or expired single sign-on request, please start again")
+	ErrSSOFailed           = errors.New("single sign-on failed, please start again")
+	ErrSSOUnavailable      = errors.New("identity provider is unavailable")
+	ErrSSOEmailNotVerified = errors.New("identity provider did not confirm the email address")
+)
+
+const (
+	// ssoStateTTL — сколько ждём возвращения пользователя со страницы входа IdP
+	ssoStateTTL = 10 * time.Minute
+	// ssoStatePrefix — начатый вход через IdP: HASH с code_verifier, nonce и device_name, ключ — state
+	ssoStatePrefix = "sso_state:"
+)
+
+// roleRank — если группы пользователя соответствуют нескольким ролям, выбирается старшая.
+// Config.Validate не допускает в OIDC_ROLE_MAPPING других ролей
+var roleRank = map[string]int{"user": 1, "manager": 2, "admin": 3}
+
+// SSO — вход через корпоративный IdP по OpenID Connect (authorization code + PKCE)
+type SSO struct {
+	provider    *oidc.Provider
+	identities  domain.IdentityRepository
+	groupsClaim string
+	roleMapping map[string]string
+	defaultRole string
+}
+
+func NewSSO(provider *oidc.Provider, identities domain.IdentityRepository, groupsClaim string, roleMapping map[string]string, defaultRole string) *SSO {
+	return &SSO{
+		provider:    provider,
+		identities:  identities,
+		groupsClaim: groupsClaim,
+		roleMapping: roleMapping,
+		defaultRole: defaultRole,
+	}
+}
+
+type SSOStartInput struct {
+	DeviceName string `json:"device_name" binding:"max=100"`
+}
+
+// SSOAuthorization — куда отправить пользователя для входа в IdP
+type SSOAuthorization struct {
+	AuthorizationURL string `json:"authorization_url"`
+	// State вернётся от IdP вместе с code; клиент может сверить его перед вызовом callback
+	State string `json:"state"`
+	// ExpiresIn — сколько секунд действует начатый вход
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// SSOCallbackInput — параметры, с которыми IdP вернул пользователя на OIDC_REDIRECT_URL
+type SSOCallbackInput struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// StartSSO начинает вход через IdP. code_verifier и nonce остаются на сервере:
+// клиент получает только адрес страницы входа
+func (s *AuthService) StartSSO(ctx context.Context, input SSOStartInput) (*SSOAuthorization, error) {
+	if s.sso == nil {
+		return nil, ErrSSONotConfigured
+	}
+
+	values := make([]string, 3)
+	for i := range values {
+		value, err := oidc.RandomString()
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := s.sso.provider.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		log.Printf("error loading identity provider metadata: %v", err)
+		return nil, ErrSSOUnavailable
+	}
+
+	key := ssoStatePrefix + state
+	pipe := s.redis.TxPipeline()
+	pipe.HSet(ctx, key, "code_verifier", verifier, "nonce", nonce, "device_name", input.DeviceName)
+	pipe.Expire(ctx, key, ssoStateTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return &SSOAuthorization{
+		AuthorizationURL: authURL,
+		State:            state,
+		ExpiresIn:        int64(ssoStateTTL.Seconds()),
+	}, nil
+}
+
+// CompleteSSO завершает вход по code от IdP. Как и Login, возвращает токены
+// или MFAChallenge, если роль требует второй фактор, а IdP его не проверил
+func (s *AuthService) CompleteSSO(ctx context.Context, input SSOCallbackInput, client SessionClient) (*AuthTokens, *MFAChallenge, error) {
+	if s.sso == nil {
+		return nil, nil, ErrSSONotConfigured
+	}
+
+	// state одноразовый: чтение и удаление в одной транзакции
+	key := ssoStatePrefix + input.State
+	pipe := s.redis.TxPipeline()
+	get := pipe.HGetAll(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, nil, err
+	}
+	state := get.Val()
+	if len(state) == 0 {
+		return nil, nil, ErrInvalidSSOState
+	}
+
+	tokens, err := s.sso.provider.Exchange(ctx, input.Code, state["code_verifier"])
+	if err != nil {
+		log.Printf("error completing single sign-on: %v", err)
+		if errors.Is(err, oidc.ErrTokenExchange) {
+			return nil, nil, ErrSSOFailed
+		}
+		return nil, nil, ErrSSOUnavailable
+	}
+	idToken, err := s.sso.provider.VerifyIDToken(ctx, tokens.IDToken, state["nonce"])
+	if err != nil {
+		log.Printf("error completing single sign-on: %v", err)
+		if errors.Is(err, oidc.ErrInvalidIDToken) {
+			return nil, nil, ErrSSOFailed
+		}
+		return nil, nil, ErrSSOUnavailable
+	}
+
+	user, err := s.resolveSSOUser(ctx, idToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Если IdP сам проверил второй фактор (amr содержит mfa), TOTP не запрашивается
+	if !slices.Contains(idToken.AMR, "mfa") {
+		required, enabled, err := s.requiresMFA(ctx, user)
+		if err != nil {
+			return nil, nil, err
+		}
+		if required {
+			challenge, err := s.startMFAChallenge(ctx, user, state["device_name"], !enabled)
+			return nil, challenge, err
+		}
+	}
+
+	authTokens, err := s.startSession(ctx, user, state["device_name"], client)
+	return authTokens, nil, err
+}
+
+// resolveSSOUser находит пользователя по аккаунту IdP. Новый аккаунт привязывается к пользователю
+// с тем же email, а если такого нет — пользователь создаётся. Роль синхронизируется с группами IdP
+func (s *AuthService) resolveSSOUser(ctx context.Context, idToken *oidc.IDToken) (*domain.User, error) {
+	issuer := s.sso.provider.Issuer()
+	role, fromGroups := s.sso.role(idToken)
+
+	identity, err := s.sso.identities.FindBySubject(ctx, issuer, idToken.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *domain.User
+	if identity != nil {
+		if user, err = s.userRepo.FindByID(ctx, identity.UserID); err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, ErrUserNotFound
+		}
+		if err := s.sso.identities.TouchLogin(ctx, identity.ID, idToken.Email); err != nil {
+			return nil, err
+		}
+	} else {
+		// Без подтверждённого email аккаунт IdP нельзя ни привязать, ни завести по нему пользователя
+		if idToken.Email == "" || !idToken.EmailVerified {
+			return nil, ErrSSOEmailNotVerified
+		}
+		identity = &domain.UserIdentity{Issuer: issuer, Subject: idToken.Subject, Email: idToken.Email}
+
+		if user, err = s.userRepo.FindByEmail(ctx, idToken.Email); err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return s.provisionSSOUser(ctx, idToken, identity, role)
+		}
+		if err := s.linkSSOIdentity(ctx, user, identity); err != nil {
+			return nil, err
+		}
+	}
+
+	// IdP — источник ролей, если группы сопоставлены с ролями: изменения применяются при следующем входе
+	if fromGroups && user.Role != role {
+		if err := s.userRepo.UpdateRole(ctx, user.ID, role); err != nil {
+			return nil, err
+		}
+		log.Printf("role of user %s changed from %s to %s by identity provider groups", user.ID, user.Role, role)
+		user.Role = role
+	}
+	return user, nil
+}
+
+// provisionSSOUser создаёт пользователя при первом входе через IdP. Пароля у него нет:
+// пустой хеш не совпадает ни с одним паролем
+func (s *AuthService) provisionSSOUser(ctx context.Context, idToken *oidc.IDToken, identity *domain.UserIdentity, role string) (*domain.User, error) {
+	user := &domain.User{
+		Email:    idToken.Email,
+		FullName: idToken.Name,
+		Role:     role,
+	}
+	if err := s.sso.identities.CreateWithUser(ctx, user, identity); err != nil {
+		return nil, fmt.Errorf("provision user from identity provider: %w", err)
+	}
+	log.Printf("user %s provisioned from identity provider with role %s", user.ID, user.Role)
+	return user, nil
+}
+
+// linkSSOIdentity привязывает аккаунт IdP к пользователю с тем же email. Аккаунт с неподтверждённым
+// email мог зарегистрировать кто угодно, поэтому его пароль сбрасывается, а сессии завершаются
+func (s *AuthService) linkSSOIdentity(ctx context.Context, user *domain.User, identity *domain.UserIdentity) error {
+	if user.EmailVerifiedAt == nil {
+		if err := s.userRepo.UpdatePassword(ctx, user.ID, ""); err != nil {
+			return err
+		}
+		if err := s.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := s.revokeAllSessions(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+
+	identity.UserID = user.ID
+	if err := s.sso.identities.Create(ctx, identity); err != nil {
+		return err
+	}
+	log.Printf("identity provider account linked to user %s", user.ID)
+	return nil
+}
+
+// role возвращает старшую из ролей, сопоставленных группам из id_token. fromGroups = true, только если
+// хотя бы одна группа есть в OIDC_ROLE_MAPPING: иначе возвращается OIDC_DEFAULT_ROLE, а роль уже
+// существующего пользователя не трогаем, чтобы не понизить назначенную вручную
+func (sso *SSO) role(idToken *oidc.IDToken) (role string, fromGroups bool) {
+	groups, ok := idToken.Strings(sso.groupsClaim)
+	if !ok {
+		return sso.defaultRole, false
+	}
+	for _, group := range groups {
+		mapped, ok := sso.roleMapping[group]
+		if ok && (role == "" || roleRank[mapped] > roleRank[role]) {
+			role = mapped
+		}
+	}
+	if role != "" {
+		return role, true
+	}
+	if len(sso.roleMapping) == 0 {
+		log.Printf("warning: identity provider sent claim %q, but OIDC_ROLE_MAPPING is empty; roles are not synchronized", sso.groupsClaim)
+	} else {
+		log.Printf("warning: none of %d identity provider groups of %s match OIDC_ROLE_MAPPING; role is not synchronized", len(groups), idToken.Subject)
+	}
+	return sso.defaultRole, false
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourname/company-superapp/internal/config"
+	"github.com/yourname/company-superapp/internal/domain"
+	"github.com/yourname/company-superapp/internal/pkg/mockidp"
+	"github.com/yourname/company-superapp/internal/pkg/oidc"
+)
+
+const ssoTestRedirectURL = "http://app.test/sso/callback"
+
+// memoryUsers и memoryIdentities — хранилища в памяти с методами, которые нужны входу через IdP
+type memoryUsers struct {
+	domain.UserRepository
+	users map[uuid.UUID]*domain.User
+}
+
+func (r *memoryUsers) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryUsers) FindByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r *memoryUsers) UpdateRole(ctx context.Context, id uuid.UUID, role string) error {
+	r.users[id].Role = role
+	return nil
+}
+
+type memoryIdentities struct {
+	users      *memoryUsers
+	identities []*domain.UserIdentity
+}
+
+func (r *memoryIdentities) FindBySubject(ctx context.Context, issuer, subject string) (*domain.UserIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			copied := *identity
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryIdentities) Create(ctx context.Context, identity *domain.UserIdentity) error {
+	identity.ID = int64(len(r.identities) + 1)
+	identity.CreatedAt = time.Now()
+	identity.LastLoginAt = identity.CreatedAt
+	copied := *identity
+	r.identities = append(r.identities, &copied)
+	return nil
+}
+
+func (r *memoryIdentities) CreateWithUser(ctx context.Context, user *domain.User, identity *domain.UserIdentity) error {
+	now := time.Now()
+	user.ID = uuid.New()
+	user.CreatedAt = now
+	user.EmailVerifiedAt = &now
+	copied := *user
+	r.users.users[user.ID] = &copied
+	identity.UserID = user.ID
+	return r.Create(ctx, identity)
+}
+
+func (r *memoryIdentities) TouchLogin(ctx context.Context, id int64, email string) error {
+	for _, identity := range r.identities {
+		if identity.ID == id {
+			identity.LastLoginAt = time.Now()
+			identity.Email = email
+		}
+	}
+	return nil
+}
+
+// ssoLogin проходит вход в Mock IdP так же, как браузер и CompleteSSO: страница входа,
+// возврат на redirect_uri с code и state, обмен code с code_verifier и проверка id_token
+func ssoLogin(t *testing.T, provider *oidc.Provider, form url.Values) *oidc.IDToken {
+	t.Helper()
+	ctx := context.Background()
+
+	code, nonce, verifier := authorize(t, provider, form)
+	tokens, err := provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("exchange code: %v", err)
+	}
+	idToken, err := provider.VerifyIDToken(ctx, tokens.IDToken, nonce)
+	if err != nil {
+		t.Fatalf("verify id_token: %v", err)
+	}
+	return idToken
+}
+
+// authorize отправляет форму входа Mock IdP и возвращает code из редиректа вместе с nonce и code_verifier
+func authorize(t *testing.T, provider *oidc.Provider, form url.Values) (code, nonce, verifier string) {
+	t.Helper()
+	values := make([]string, 3)
+	for i := range values {
+		value, err := oidc.RandomString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := provider.AuthCodeURL(context.Background(), state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		t.Fatalf("authorization URL: %v", err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.PostForm(authURL, form)
+	if err != nil {
+		t.Fatalf("submit login form: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("login form: status %d, want redirect", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != ssoTestRedirectURL {
+		t.Fatalf("redirected to %s, want %s", got, ssoTestRedirectURL)
+	}
+	if location.Query().Get("state") != state {
+		t.Fatalf("state %q, want %q", location.Query().Get("state"), state)
+	}
+	return location.Query().Get("code"), nonce, verifier
+}
+
+func loginForm(email, groups string) url.Values {
+	return url.Values{"email": {email}, "name": {"Test User"}, "groups": {groups}, "email_verified": {"true"}}
+}
+
+// TestSSOAgainstMockIdP проходит authorization code flow с PKCE против Mock IdP
+// и проверяет создание пользователя при первом входе и синхронизацию роли с группами
+func TestSSOAgainstMockIdP(t *testing.T) {
+	server := httptest.NewUnstartedServer(nil)
+	idp, err := mockidp.New("http://"+server.Listener.Addr().String(), "superapp", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Config.Handler = idp.Handler()
+	server.Start()
+	defer server.Close()
+
+	provider := oidc.NewProvider(config.OIDCConfig{
+		IssuerURL:    idp.Issuer(),
+		ClientID:     "superapp",
+		ClientSecret: "secret",
+		RedirectURL:  ssoTestRedirectURL,
+		Scopes:       []string{"openid", "email", "profile", "groups"},
+	})
+	users := &memoryUsers{users: make(map[uuid.UUID]*domain.User)}
+	identities := &memoryIdentities{users: users}
+	mapping := map[string]string{"superapp-admins": "admin", "superapp-managers": "manager", "superapp-users": "user"}
+	auth := &AuthService{userRepo: users, sso: NewSSO(provider, identities, "groups", mapping, "user")}
+	ctx := context.Background()
+
+	t.Run("code requires the PKCE verifier", func(t *testing.T) {
+		code, _, _ := authorize(t, provider, loginForm("pkce@company.local", ""))
+		if _, err := provider.Exchange(ctx, code, "wrong-verifier"); !errors.Is(err, oidc.ErrTokenExchange) {
+			t.Fatalf("exchange with wrong verifier: %v, want ErrTokenExchange", err)
+		}
+	})
+
+	t.Run("id_token is bound to the nonce", func(t *testing.T) {
+		code, _, verifier := authorize(t, provider, loginForm("nonce@company.local", ""))
+		tokens, err := provider.Exchange(ctx, code, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := provider.VerifyIDToken(ctx, tokens.IDToken, "other-nonce"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+			t.Fatalf("verify with other nonce: %v, want ErrInvalidIDToken", err)
+		}
+	})
+
+	var alice *domain.User
+	t.Run("first login provisions the user with the mapped role", func(t *testing.T) {
+		user, err := auth.resolveSSOUser(ctx, ssoLogin(t, provider, loginForm("alice@company.local", "superapp-admins,superapp-users")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Role != "admin" || user.EmailVerifiedAt == nil {
+			t.Fatalf("provisioned user: role %q, verified %v", user.Role, user.EmailVerifiedAt != nil)
+		}
+		if len(identities.identities) != 1 || identities.identities[0].UserID != user.ID || identities.identities[0].Issuer != idp.Issuer() {
+			t.Fatalf("identity is not linked: %+v", identities.identities)
+		}
+		alice = user
+	})
+	if alice == nil {
+		t.FailNow()
+	}
+
+	roleOf := func(t *testing.T, form url.Values) string {
+		t.Helper()
+		user, err := auth.resolveSSOUser(ctx, ssoLogin(t, provider, form))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != alice.ID {
+			t.Fatalf("login resolved to user %s, want %s", user.ID, alice.ID)
+		}
+		if stored := users.users[alice.ID].Role; stored != user.Role {
+			t.Fatalf("returned role %q, stored %q", user.Role, stored)
+		}
+		return user.Role
+	}
+
+	t.Run("groups without a mapping keep the role", func(t *testing.T) {
+		if role := roleOf(t, loginForm("alice@company.local", "unmapped-group")); role != "admin" {
+			t.Fatalf("role %q, want admin", role)
+		}
+	})
+
+	t.Run("mapped groups change the role", func(t *testing.T) {
+		if role := roleOf(t, loginForm("alice@company.local", "superapp-managers")); role != "manager" {
+			t.Fatalf("role %q, want manager", role)
+		}
+	})
+
+	t.Run("empty mapping never changes the role", func(t *testing.T) {
+		auth.sso.roleMapping = map[string]string{}
+		defer func() { auth.sso.roleMapping = mapping }()
+		if role := roleOf(t, loginForm("alice@company.local", "superapp-admins")); role != "manager" {
+			t.Fatalf("role %q, want manager", role)
+		}
+	})
+
+	t.Run("a group mapped to user is not promoted to the default role", func(t *testing.T) {
+		auth.sso.defaultRole = "manager"
+		defer func() { auth.sso.defaultRole = "user" }()
+		user, err := auth.resolveSSOUser(ctx, ssoLogin(t, provider, loginForm("bob@company.local", "superapp-users")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Role != "user" {
+			t.Fatalf("role %q, want user", user.Role)
+		}
+	})
+
+	t.Run("unverified email is not provisioned", func(t *testing.T) {
+		form := loginForm("carol@company.local", "superapp-users")
+		form.Del("email_verified")
+		if _, err := auth.resolveSSOUser(ctx, ssoLogin(t, provider, form)); !errors.Is(err, ErrSSOEmailNotVerified) {
+			t.Fatalf("unverified email: %v, want ErrSSOEmailNotVerified", err)
+		}
+	})
+}
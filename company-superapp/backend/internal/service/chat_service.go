@@ -2,30 +2,852 @@ package service
 
 import (
 	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/yourname/company-superapp/internal/domain"
+	"github.com/yourname/company-superapp/internal/pkg/metrics"
+)
+
+var (
+	ErrNotChatMember      = errors.New("user is not a member of this chat")
+	ErrEmptyMessage       = errors.New("message content is empty")
+	ErrChatNotFound       = errors.New("chat not found")
+	ErrNotChatOwner       = errors.New("only the chat owner can do this")
+	ErrNotGroupChat       = errors.New("operation is only allowed for group chats")
+	ErrAlreadyChatMember  = errors.New("user is already a member of this chat")
+	ErrInvalidChatMembers = errors.New("invalid chat members")
+	ErrChatNameRequired   = errors.New("group chat name is required")
+	ErrInvalidCursor      = errors.New("before_id and after_id cannot be used together")
+	ErrMessageNotFound    = errors.New("message not found")
+	ErrNotMessageAuthor   = errors.New("only the author can change this message")
+	ErrMessageDeleted     = errors.New("message has been deleted")
+	ErrModeratorOnly      = errors.New("only admins can permanently delete messages")
+	ErrInvalidReaction    = errors.New("invalid reaction emoji")
+	ErrInvalidAttachment  = errors.New("attachment cannot be sent with this message")
+	ErrTooManyAttachments = errors.New("too many attachments")
+	ErrInvalidMuteUntil   = errors.New("mute end time must be in the future")
+	ErrInvalidClientMsgID = errors.New("invalid client_msg_id")
+	ErrClientMsgIDReused  = errors.New("client_msg_id is already used in another chat")
+)
+
+const (
+	defaultMessagePageSize = 50
+	maxMessagePageSize     = 100
+	maxSyncBatchSize       = 500
+	// maxReactionLength — ограничение в байтах: с запасом для эмодзи из нескольких code points
+	maxReactionLength = 32
+	// maxMessageAttachments — сколько файлов можно отправить одним сообщением
+	maxMessageAttachments = 10
+	// maxMessageMentions — сколько упоминаний одного сообщения разбирается
+	maxMessageMentions = 50
+	// maxClientMsgIDLength — длина client_msg_id в байтах (VARCHAR(64) в БД)
+	maxClientMsgIDLength = 64
+)
+
+// Упоминания: @email участника или @<user id>
+var (
+	emailMentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@([\w.%+\-]+@[\w\-]+(?:\.[\w\-]+)+)`)
+	idMentionPattern    = regexp.MustCompile(`(?:^|[^\w@])@([0-9a-fA-F]{8}(?:-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12})`)
 )
 
 type ChatService struct {
-	chatRepo    domain.ChatRepository
-	messageRepo domain.MessageRepository
+	chatRepo       domain.ChatRepository
+	messageRepo    domain.MessageRepository
+	userRepo       domain.UserRepository
+	reactionRepo   domain.ReactionRepository
+	attachmentRepo domain.AttachmentRepository
+	pushService    *MessagePushService
 }
 
-func NewChatService(chatRepo domain.ChatRepository, messageRepo domain.MessageRepository) *ChatService {
+func NewChatService(chatRepo domain.ChatRepository, messageRepo domain.MessageRepository, userRepo domain.UserRepository, reactionRepo domain.ReactionRepository, attachmentRepo domain.AttachmentRepository, pushService *MessagePushService) *ChatService {
 	return &ChatService{
-		chatRepo:    chatRepo,
-		messageRepo: messageRepo,
+		chatRepo:       chatRepo,
+		messageRepo:    messageRepo,
+		userRepo:       userRepo,
+		reactionRepo:   reactionRepo,
+		attachmentRepo: attachmentRepo,
+		pushService:    pushService,
 	}
 }
 
-func (s *ChatService) GetUserChats(ctx context.Context, userID uuid.UUID) ([]domain.Chat, error) {
+// GetUserChats возвращает чаты пользователя с непрочитанными и превью последнего сообщения
+func (s *ChatService) GetUserChats(ctx context.Context, userID uuid.UUID) ([]domain.ChatSummary, error) {
 	return s.chatRepo.GetChatsByUserID(ctx, userID)
 }
 
-func (s *ChatService) GetChatMessages(ctx context.Context, chatID uuid.UUID, userID uuid.UUID, page, pageSize int) ([]domain.Message, error) {
-	// Here you would add logic to check if userID is a member of chatID
-	// For now, we'll skip that for brevity.
-	offset := (page - 1) * pageSize
-	return s.messageRepo.GetMessagesByChatID(ctx, chatID, pageSize, offset)
+// MessagePage — страница истории чата
+type MessagePage struct {
+	Messages []domain.Message `json:"messages"`
+	HasMore  bool             `json:"has_more"`
+}
+
+// GetChatMessages возвращает страницу истории по курсору на messages.id; доступно только участникам
+func (s *ChatService) GetChatMessages(ctx context.Context, chatID uuid.UUID, userID uuid.UUID, cursor domain.MessageCursor) (*MessagePage, error) {
+	if cursor.BeforeID != nil && cursor.AfterID != nil {
+		return nil, ErrInvalidCursor
+	}
+	if err := s.requireMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+
+	limit := clampLimit(cursor.Limit, defaultMessagePageSize, maxMessagePageSize)
+	// Запрашиваем на одну запись больше, чтобы узнать, есть ли следующая страница
+	cursor.Limit = limit + 1
+	messages, err := s.messageRepo.GetMessagesByChatID(ctx, chatID, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &MessagePage{Messages: messages, HasMore: len(messages) > limit}
+	if page.HasMore {
+		page.Messages = messages[:limit]
+	}
+	if page.Messages == nil {
+		page.Messages = []domain.Message{}
+	}
+	if err := s.attachDetails(ctx, userID, page.Messages); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// SyncResult — сообщения, пропущенные клиентом, пока он был офлайн
+type SyncResult struct {
+	Messages []domain.Message `json:"messages"`
+	HasMore  bool             `json:"has_more"`
+	// LastID — значение since_id для следующего запроса
+	LastID int64 `json:"last_id"`
+}
+
+// SyncMessages возвращает сообщения всех чатов пользователя с id больше sinceID.
+// Клиент повторяет запрос с last_id, пока has_more = true.
+func (s *ChatService) SyncMessages(ctx context.Context, userID uuid.UUID, sinceID int64, limit int) (*SyncResult, error) {
+	limit = clampLimit(limit, maxSyncBatchSize, maxSyncBatchSize)
+	messages, err := s.messageRepo.GetMessagesSince(ctx, userID, sinceID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{Messages: messages, HasMore: len(messages) > limit, LastID: sinceID}
+	if result.HasMore {
+		result.Messages = messages[:limit]
+	}
+	if result.Messages == nil {
+		result.Messages = []domain.Message{}
+	}
+	if n := len(result.Messages); n > 0 {
+		result.LastID = result.Messages[n-1].ID
+	}
+	if err := s.attachDetails(ctx, userID, result.Messages); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// IsMember проверяет, состоит ли пользователь в чате
+func (s *ChatService) IsMember(ctx context.Context, chatID, userID uuid.UUID) (bool, error) {
+	return s.chatRepo.IsMember(ctx, chatID, userID)
+}
+
+// SendMessageInput — новое сообщение; ReplyToID задаётся для ответа, ответ попадает в тред исходного сообщения.
+// AttachmentIDs — подтверждённые вложения, загруженные отправителем в этот чат.
+// ClientMsgID — необязательный идентификатор от клиента, делающий повторную отправку безопасной.
+type SendMessageInput struct {
+	Content       string
+	ReplyToID     *int64
+	AttachmentIDs []uuid.UUID
+	ClientMsgID   string
+}
+
+// SendMessage сохраняет сообщение участника чата и возвращает его с ID и временем создания из БД.
+// Повтор с тем же ClientMsgID возвращает уже сохранённое сообщение и created = false.
+func (s *ChatService) SendMessage(ctx context.Context, chatID, senderID uuid.UUID, input SendMessageInput) (*domain.Message, bool, error) {
+	if len(input.ClientMsgID) > maxClientMsgIDLength {
+		return nil, false, ErrInvalidClientMsgID
+	}
+	if strings.TrimSpace(input.Content) == "" && len(input.AttachmentIDs) == 0 {
+		return nil, false, ErrEmptyMessage
+	}
+	if len(input.AttachmentIDs) > maxMessageAttachments {
+		return nil, false, ErrTooManyAttachments
+	}
+
+	if err := s.requireMember(ctx, chatID, senderID); err != nil {
+		return nil, false, err
+	}
+
+	msg := &domain.Message{
+		ChatID:   chatID,
+		SenderID: senderID,
+		Content:  input.Content,
+	}
+	if input.ClientMsgID != "" {
+		// Проверка до вложений: при повторе они уже привязаны к сохранённому сообщению
+		existing, err := s.messageRepo.GetByClientMsgID(ctx, senderID, input.ClientMsgID)
+		if err != nil {
+			return nil, false, err
+		}
+		if existing != nil {
+			return resentMessage(existing, chatID)
+		}
+		msg.ClientMsgID = &input.ClientMsgID
+	}
+
+	attachments, err := s.getSendableAttachments(ctx, chatID, senderID, uniqueIDs(input.AttachmentIDs))
+	if err != nil {
+		return nil, false, err
+	}
+	if input.ReplyToID != nil {
+		target, err := s.getChatMessage(ctx, chatID, *input.ReplyToID)
+		if err != nil {
+			return nil, false, err
+		}
+		if target.DeletedAt != nil {
+			return nil, false, ErrMessageDeleted
+		}
+		msg.ReplyToID = &target.ID
+		msg.ThreadRootID = threadRootOf(target)
+	}
+	msg.Attachments = attachments
+	if msg.Mentions, err = s.resolveMentions(ctx, chatID, senderID, input.Content); err != nil {
+		return nil, false, err
+	}
+
+	created, err := s.messageRepo.Create(ctx, msg)
+	if err != nil {
+		return nil, false, err
+	}
+	if !created {
+		// Параллельный повтор успел сохранить сообщение раньше
+		return resentMessage(msg, chatID)
+	}
+
+	metrics.MessagesTotal.Inc()
+	s.pushService.NotifyNewMessage(msg)
+	return msg, true, nil
+}
+
+// resentMessage проверяет, что повторно отправленное сообщение относится к тому же чату
+func resentMessage(msg *domain.Message, chatID uuid.UUID) (*domain.Message, bool, error) {
+	if msg.ChatID != chatID {
+		return nil, false, ErrClientMsgIDReused
+	}
+	return msg, false, nil
+}
+
+// resolveMentions находит в тексте упоминания участников чата (кроме отправителя)
+func (s *ChatService) resolveMentions(ctx context.Context, chatID, senderID uuid.UUID, content string) ([]uuid.UUID, error) {
+	if !strings.Contains(content, "@") {
+		return nil, nil
+	}
+
+	emails := make(map[string]bool)
+	for _, match := range emailMentionPattern.FindAllStringSubmatch(content, maxMessageMentions) {
+		emails[strings.ToLower(match[1])] = true
+	}
+	ids := make(map[uuid.UUID]bool)
+	for _, match := range idMentionPattern.FindAllStringSubmatch(content, maxMessageMentions) {
+		if id, err := uuid.Parse(match[1]); err == nil {
+			ids[id] = true
+		}
+	}
+	if len(emails) == 0 && len(ids) == 0 {
+		return nil, nil
+	}
+
+	members, err := s.chatRepo.GetMembers(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	var mentioned []uuid.UUID
+	for _, member := range members {
+		if member.UserID == senderID {
+			continue
+		}
+		if ids[member.UserID] || emails[strings.ToLower(member.Email)] {
+			mentioned = append(mentioned, member.UserID)
+		}
+	}
+	return mentioned, nil
+}
+
+// GetMentions возвращает сообщения, в которых упомянут пользователь, от новых к старым
+func (s *ChatService) GetMentions(ctx context.Context, userID uuid.UUID, beforeID *int64, limit int) (*MessagePage, error) {
+	limit = clampLimit(limit, defaultMessagePageSize, maxMessagePageSize)
+	messages, err := s.messageRepo.GetMentions(ctx, userID, domain.MessageCursor{BeforeID: beforeID, Limit: limit + 1})
+	if err != nil {
+		return nil, err
+	}
+
+	page := &MessagePage{Messages: messages, HasMore: len(messages) > limit}
+	if page.HasMore {
+		page.Messages = messages[:limit]
+	}
+	if page.Messages == nil {
+		page.Messages = []domain.Message{}
+	}
+	if err := s.attachDetails(ctx, userID, page.Messages); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// getSendableAttachments проверяет, что вложения загружены отправителем в этот чат и ещё не отправлены
+func (s *ChatService) getSendableAttachments(ctx context.Context, chatID, senderID uuid.UUID, ids []uuid.UUID) ([]domain.Attachment, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	attachments, err := s.attachmentRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) != len(ids) {
+		return nil, ErrInvalidAttachment
+	}
+	for _, attachment := range attachments {
+		if attachment.ChatID != chatID || attachment.UploaderID != senderID ||
+			attachment.Status != domain.AttachmentStatusUploaded || attachment.MessageID != nil {
+			return nil, ErrInvalidAttachment
+		}
+	}
+	return attachments, nil
+}
+
+// ThreadPage — корневое сообщение треда и страница ответов
+type ThreadPage struct {
+	Root     *domain.Message  `json:"root"`
+	Messages []domain.Message `json:"messages"`
+	HasMore  bool             `json:"has_more"`
+}
+
+// GetThread возвращает тред сообщения messageID; для ответа возвращается тред, в котором он находится
+func (s *ChatService) GetThread(ctx context.Context, userID, chatID uuid.UUID, messageID int64, cursor domain.MessageCursor) (*ThreadPage, error) {
+	if cursor.BeforeID != nil && cursor.AfterID != nil {
+		return nil, ErrInvalidCursor
+	}
+	if err := s.requireMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+	root, err := s.getChatMessage(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if root.ThreadRootID != nil {
+		if root, err = s.getChatMessage(ctx, chatID, *root.ThreadRootID); err != nil {
+			return nil, err
+		}
+	}
+
+	limit := clampLimit(cursor.Limit, defaultMessagePageSize, maxMessagePageSize)
+	cursor.Limit = limit + 1
+	replies, err := s.messageRepo.GetThreadReplies(ctx, root.ID, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ThreadPage{Root: root, Messages: replies, HasMore: len(replies) > limit}
+	if page.HasMore {
+		page.Messages = replies[:limit]
+	}
+	if page.Messages == nil {
+		page.Messages = []domain.Message{}
+	}
+	if err := s.attachDetails(ctx, userID, page.Messages); err != nil {
+		return nil, err
+	}
+	roots := []domain.Message{*root}
+	if err := s.attachDetails(ctx, userID, roots); err != nil {
+		return nil, err
+	}
+	page.Root = &roots[0]
+	return page, nil
+}
+
+type EditMessageInput struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// EditMessage меняет текст сообщения; предыдущая версия сохраняется в истории правок
+func (s *ChatService) EditMessage(ctx context.Context, userID, chatID uuid.UUID, messageID int64, content string) (*domain.Message, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, ErrEmptyMessage
+	}
+	if err := s.requireMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+	msg, err := s.getChatMessage(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SenderID != userID {
+		return nil, ErrNotMessageAuthor
+	}
+	if msg.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+
+	if err := s.messageRepo.UpdateContent(ctx, msg, userID, content); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// DeleteMessage удаляет сообщение. Автор, пока состоит в чате, удаляет мягко (остаётся надгробие),
+// администратор может удалить сообщение безвозвратно (hard = true).
+func (s *ChatService) DeleteMessage(ctx context.Context, userID uuid.UUID, role string, chatID uuid.UUID, messageID int64, hard bool) (*domain.Message, error) {
+	msg, err := s.getChatMessage(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if hard {
+		if role != "admin" {
+			return nil, ErrModeratorOnly
+		}
+		if err := s.messageRepo.HardDelete(ctx, msg.ID); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+
+	if err := s.requireMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+	if msg.SenderID != userID {
+		return nil, ErrNotMessageAuthor
+	}
+	if msg.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+	if err := s.messageRepo.SoftDelete(ctx, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// GetMessageHistory возвращает предыдущие версии сообщения; доступно участникам чата.
+// История удалённого сообщения видна только администратору
+func (s *ChatService) GetMessageHistory(ctx context.Context, userID uuid.UUID, role string, chatID uuid.UUID, messageID int64) ([]domain.MessageEdit, error) {
+	if role != "admin" {
+		if err := s.requireMember(ctx, chatID, userID); err != nil {
+			return nil, err
+		}
+	}
+	msg, err := s.getChatMessage(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.DeletedAt != nil && role != "admin" {
+		return nil, ErrMessageDeleted
+	}
+	edits, err := s.messageRepo.GetEdits(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if edits == nil {
+		edits = []domain.MessageEdit{}
+	}
+	return edits, nil
+}
+
+func (s *ChatService) getChatMessage(ctx context.Context, chatID uuid.UUID, messageID int64) (*domain.Message, error) {
+	msg, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil || msg.ChatID != chatID {
+		return nil, ErrMessageNotFound
+	}
+	return msg, nil
+}
+
+type MarkReadInput struct {
+	MessageID int64 `json:"message_id" binding:"required,min=1"`
+}
+
+// ReadReceipt — позиция прочтения участника чата
+type ReadReceipt struct {
+	ChatID            uuid.UUID `json:"chat_id"`
+	UserID            uuid.UUID `json:"user_id"`
+	LastReadMessageID int64     `json:"last_read_message_id"`
+}
+
+// MarkRead отмечает сообщения чата до messageID включительно прочитанными.
+// Позиция только растёт: advanced = false, если пользователь уже прочитал это сообщение.
+func (s *ChatService) MarkRead(ctx context.Context, userID, chatID uuid.UUID, messageID int64) (*ReadReceipt, bool, error) {
+	if err := s.requireMember(ctx, chatID, userID); err != nil {
+		return nil, false, err
+	}
+	if _, err := s.getChatMessage(ctx, chatID, messageID); err != nil {
+		return nil, false, err
+	}
+
+	advanced, err := s.chatRepo.MarkRead(ctx, chatID, userID, messageID)
+	if err != nil {
+		return nil, false, err
+	}
+	return &ReadReceipt{ChatID: chatID, UserID: userID, LastReadMessageID: messageID}, advanced, nil
+}
+
+type ReactionInput struct {
+	Emoji string `json:"emoji" binding:"required"`
+}
+
+// Reaction — реакция пользователя на сообщение чата
+type Reaction struct {
+	ChatID    uuid.UUID `json:"chat_id"`
+	MessageID int64     `json:"message_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Emoji     string    `json:"emoji"`
+}
+
+// AddReaction ставит реакцию на сообщение; changed = false, если такая реакция уже стоит
+func (s *ChatService) AddReaction(ctx context.Context, userID, chatID uuid.UUID, messageID int64, emoji string) (*Reaction, bool, error) {
+	reaction, err := s.prepareReaction(ctx, userID, chatID, messageID, emoji)
+	if err != nil {
+		return nil, false, err
+	}
+	changed, err := s.reactionRepo.Add(ctx, messageID, userID, reaction.Emoji)
+	if err != nil {
+		return nil, false, err
+	}
+	return reaction, changed, nil
+}
+
+// RemoveReaction снимает реакцию; changed = false, если её не было
+func (s *ChatService) RemoveReaction(ctx context.Context, userID, chatID uuid.UUID, messageID int64, emoji string) (*Reaction, bool, error) {
+	reaction, err := s.prepareReaction(ctx, userID, chatID, messageID, emoji)
+	if err != nil {
+		return nil, false, err
+	}
+	changed, err := s.reactionRepo.Remove(ctx, messageID, userID, reaction.Emoji)
+	if err != nil {
+		return nil, false, err
+	}
+	return reaction, changed, nil
+}
+
+func (s *ChatService) prepareReaction(ctx context.Context, userID, chatID uuid.UUID, messageID int64, emoji string) (*Reaction, error) {
+	emoji = strings.TrimSpace(emoji)
+	if emoji == "" || len(emoji) > maxReactionLength || strings.ContainsAny(emoji, " \t\n") {
+		return nil, ErrInvalidReaction
+	}
+	if err := s.requireMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+	msg, err := s.getChatMessage(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+	return &Reaction{ChatID: chatID, MessageID: messageID, UserID: userID, Emoji: emoji}, nil
+}
+
+// attachDetails заполняет реакции и вложения сообщений — по одному запросу на всю страницу
+func (s *ChatService) attachDetails(ctx context.Context, userID uuid.UUID, messages []domain.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+	}
+	summaries, err := s.reactionRepo.GetSummaries(ctx, ids, userID)
+	if err != nil {
+		return err
+	}
+	attachments, err := s.attachmentRepo.GetByMessageIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Reactions = summaries[messages[i].ID]
+		messages[i].Attachments = attachments[messages[i].ID]
+	}
+	return nil
+}
+
+type CreateChatInput struct {
+	Type      string      `json:"type" binding:"required,oneof=private group"`
+	Name      string      `json:"name"`
+	MemberIDs []uuid.UUID `json:"member_ids" binding:"required,min=1"`
+}
+
+// CreateChatResult — созданный (или найденный личный) чат и его участники
+type CreateChatResult struct {
+	Chat      *domain.Chat
+	MemberIDs []uuid.UUID
+	Created   bool
+}
+
+// CreateChat создаёт групповой чат или личный чат с одним собеседником.
+// Личный чат для пары пользователей всегда один: повторный вызов вернёт существующий.
+func (s *ChatService) CreateChat(ctx context.Context, creatorID uuid.UUID, input CreateChatInput) (*CreateChatResult, error) {
+	memberIDs := uniqueIDs(append([]uuid.UUID{creatorID}, input.MemberIDs...))
+	if err := s.ensureUsersExist(ctx, memberIDs); err != nil {
+		return nil, err
+	}
+
+	if input.Type == domain.ChatTypePrivate {
+		if len(memberIDs) != 2 {
+			return nil, ErrInvalidChatMembers
+		}
+		peerID := memberIDs[1]
+		key := privateChatKey(creatorID, peerID)
+		chat := &domain.Chat{
+			Type:       domain.ChatTypePrivate,
+			CreatedBy:  &creatorID,
+			PrivateKey: &key,
+		}
+		created, err := s.chatRepo.CreatePrivate(ctx, chat, creatorID, peerID)
+		if err != nil {
+			return nil, err
+		}
+		return &CreateChatResult{Chat: chat, MemberIDs: memberIDs, Created: created}, nil
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, ErrChatNameRequired
+	}
+	chat := &domain.Chat{
+		Type:      domain.ChatTypeGroup,
+		Name:      &name,
+		CreatedBy: &creatorID,
+	}
+	if err := s.chatRepo.CreateWithMembers(ctx, chat, creatorID, memberIDs); err != nil {
+		return nil, err
+	}
+
+	return &CreateChatResult{Chat: chat, MemberIDs: memberIDs, Created: true}, nil
+}
+
+// GetMembers возвращает участников чата; доступно только участникам
+func (s *ChatService) GetMembers(ctx context.Context, actorID, chatID uuid.UUID) ([]domain.ChatMember, error) {
+	if err := s.requireMember(ctx, chatID, actorID); err != nil {
+		return nil, err
+	}
+	return s.chatRepo.GetMembers(ctx, chatID)
+}
+
+// AddMember добавляет пользователя в групповой чат; добавлять может любой участник
+func (s *ChatService) AddMember(ctx context.Context, actorID, chatID, userID uuid.UUID) error {
+	if _, err := s.getGroupChat(ctx, chatID); err != nil {
+		return err
+	}
+	if err := s.requireMember(ctx, chatID, actorID); err != nil {
+		return err
+	}
+	if err := s.ensureUsersExist(ctx, []uuid.UUID{userID}); err != nil {
+		return err
+	}
+
+	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if isMember {
+		return ErrAlreadyChatMember
+	}
+
+	return s.chatRepo.AddMember(ctx, chatID, userID)
+}
+
+// RemoveMember исключает участника из группового чата; доступно только владельцу
+func (s *ChatService) RemoveMember(ctx context.Context, actorID, chatID, userID uuid.UUID) error {
+	if actorID == userID {
+		return s.LeaveChat(ctx, actorID, chatID)
+	}
+	if _, err := s.getGroupChat(ctx, chatID); err != nil {
+		return err
+	}
+	if err := s.requireOwner(ctx, chatID, actorID); err != nil {
+		return err
+	}
+	if err := s.requireMember(ctx, chatID, userID); err != nil {
+		return err
+	}
+
+	return s.chatRepo.RemoveMember(ctx, chatID, userID)
+}
+
+// LeaveChat выводит пользователя из группового чата.
+// Если уходит владелец, владельцем становится участник, вступивший раньше остальных.
+func (s *ChatService) LeaveChat(ctx context.Context, userID, chatID uuid.UUID) error {
+	if _, err := s.getGroupChat(ctx, chatID); err != nil {
+		return err
+	}
+	member, err := s.chatRepo.GetMember(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		return ErrNotChatMember
+	}
+
+	if err := s.chatRepo.RemoveMember(ctx, chatID, userID); err != nil {
+		return err
+	}
+	if member.Role == domain.ChatRoleOwner {
+		return s.chatRepo.TransferOwnership(ctx, chatID)
+	}
+	return nil
+}
+
+type RenameChatInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// RenameChat меняет название группового чата; доступно только владельцу
+func (s *ChatService) RenameChat(ctx context.Context, actorID, chatID uuid.UUID, name string) (*domain.Chat, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrChatNameRequired
+	}
+	chat, err := s.getGroupChat(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireOwner(ctx, chatID, actorID); err != nil {
+		return nil, err
+	}
+
+	if err := s.chatRepo.UpdateName(ctx, chatID, name); err != nil {
+		return nil, err
+	}
+	chat.Name = &name
+	return chat, nil
+}
+
+// MuteChatInput — Until не задан: уведомления отключены до ручного включения
+type MuteChatInput struct {
+	Until *time.Time `json:"until"`
+}
+
+// ChatMute — настройка уведомлений чата для участника
+type ChatMute struct {
+	ChatID     uuid.UUID  `json:"chat_id"`
+	Muted      bool       `json:"muted"`
+	MutedUntil *time.Time `json:"muted_until,omitempty"`
+}
+
+// MuteChat отключает push-уведомления о новых сообщениях чата; упоминания продолжают приходить
+func (s *ChatService) MuteChat(ctx context.Context, userID, chatID uuid.UUID, until *time.Time) (*ChatMute, error) {
+	if until != nil && !until.After(time.Now()) {
+		return nil, ErrInvalidMuteUntil
+	}
+	if err := s.requireMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.chatRepo.SetMute(ctx, chatID, userID, true, until); err != nil {
+		return nil, err
+	}
+	return &ChatMute{ChatID: chatID, Muted: true, MutedUntil: until}, nil
+}
+
+// UnmuteChat включает уведомления чата
+func (s *ChatService) UnmuteChat(ctx context.Context, userID, chatID uuid.UUID) (*ChatMute, error) {
+	if err := s.requireMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.chatRepo.SetMute(ctx, chatID, userID, false, nil); err != nil {
+		return nil, err
+	}
+	return &ChatMute{ChatID: chatID}, nil
+}
+
+func (s *ChatService) getGroupChat(ctx context.Context, chatID uuid.UUID) (*domain.Chat, error) {
+	chat, err := s.chatRepo.GetByID(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if chat == nil {
+		return nil, ErrChatNotFound
+	}
+	if chat.Type != domain.ChatTypeGroup {
+		return nil, ErrNotGroupChat
+	}
+	return chat, nil
+}
+
+func (s *ChatService) requireMember(ctx context.Context, chatID, userID uuid.UUID) error {
+	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrNotChatMember
+	}
+	return nil
+}
+
+func (s *ChatService) requireOwner(ctx context.Context, chatID, userID uuid.UUID) error {
+	member, err := s.chatRepo.GetMember(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		return ErrNotChatMember
+	}
+	if member.Role != domain.ChatRoleOwner {
+		return ErrNotChatOwner
+	}
+	return nil
+}
+
+func (s *ChatService) ensureUsersExist(ctx context.Context, ids []uuid.UUID) error {
+	users, err := s.userRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	if len(users) != len(ids) {
+		return ErrInvalidChatMembers
+	}
+	return nil
+}
+
+// threadRootOf возвращает корень треда, в который попадёт ответ на msg
+func threadRootOf(msg *domain.Message) *int64 {
+	if msg.ThreadRootID != nil {
+		return msg.ThreadRootID
+	}
+	return &msg.ID
+}
+
+// privateChatKey не зависит от порядка пользователей в паре
+func privateChatKey(a, b uuid.UUID) string {
+	if a.String() > b.String() {
+		a, b = b, a
+	}
+	return a.String() + ":" + b.String()
+}
+
+func clampLimit(limit, defaultLimit, maxLimit int) int {
+	if limit <= 0 {
+		return defaultLimit
+	}
+	if limit > maxLimit {
+		return maxLimit
+	}
+	return limit
+}
+
+// uniqueIDs убирает дубликаты, сохраняя порядок
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	result := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if id == uuid.Nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
 }
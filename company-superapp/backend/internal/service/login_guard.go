@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/company-superapp/internal/pkg/ratelimit"
+)
+
+var (
+	ErrTooManyAttempts = errors.New("too many login attempts, try again later")
+	ErrAccountLocked   = errors.New("account is temporarily locked after repeated failed logins")
+)
+
+const (
+	// Ограничения частоты считают все попытки входа, удачные тоже
+	loginIPLimit         = 20
+	loginIPWindow        = time.Minute
+	loginEmailLimit      = 10
+	loginEmailWindow     = 15 * time.Minute
+	loginRateIPPrefix    = "login_rate:ip:"
+	loginRateEmailPrefix = "login_rate:email:"
+
+	// lockoutThreshold неудачных попыток за lockoutWindow блокируют вход на lockoutBase,
+	// каждая следующая блокировка вдвое дольше, но не больше lockoutMax
+	lockoutThreshold = 5
+	lockoutWindow    = 15 * time.Minute
+	lockoutBase      = time.Minute
+	lockoutMax       = 24 * time.Hour
+	// lockoutLevelTTL — через сколько после последней блокировки её длительность сбрасывается
+	lockoutLevelTTL = 24 * time.Hour
+
+	loginFailuresPrefix  = "login_failures:"
+	loginLockLevelPrefix = "login_lock_level:"
+	loginLockedPrefix    = "login_locked:"
+)
+
+// recordFailureScript учитывает неудачную попытку и при достижении порога блокирует вход.
+// Возвращает длительность новой блокировки в миллисекундах или 0
+var recordFailureScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local window = tonumber(ARGV[1])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+redis.call('ZADD', KEYS[1], now, ARGV[6])
+redis.call('PEXPIRE', KEYS[1], window)
+if redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[2]) then
+	return 0
+end
+
+redis.call('DEL', KEYS[1])
+local level = redis.call('INCR', KEYS[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[5])
+local duration = math.min(tonumber(ARGV[3]) * 2 ^ (level - 1), tonumber(ARGV[4]))
+redis.call('SET', KEYS[3], level, 'PX', duration)
+return duration
+`)
+
+// RetryAfterError — отказ из-за ограничения частоты или блокировки; RetryAfter — когда можно повторить
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// LoginGuard защищает вход от перебора паролей: ограничивает частоту попыток с одного IP
+// и для одного email, а после серии неудач временно блокирует вход в аккаунт
+type LoginGuard struct {
+	redis   *redis.Client
+	byIP    *ratelimit.SlidingWindow
+	byEmail *ratelimit.SlidingWindow
+}
+
+func NewLoginGuard(redisClient *redis.Client) *LoginGuard {
+	return &LoginGuard{
+		redis:   redisClient,
+		byIP:    ratelimit.NewSlidingWindow(redisClient, loginRateIPPrefix, loginIPLimit, loginIPWindow),
+		byEmail: ratelimit.NewSlidingWindow(redisClient, loginRateEmailPrefix, loginEmailLimit, loginEmailWindow),
+	}
+}
+
+// Check вызывается до проверки пароля: заблокированный аккаунт не принимает даже верный пароль.
+// Email не обязан принадлежать пользователю — несуществующие адреса ограничиваются так же
+func (g *LoginGuard) Check(ctx context.Context, email, ip string) error {
+	email = normalizeLoginEmail(email)
+
+	locked, err := g.redis.PTTL(ctx, loginLockedPrefix+email).Result()
+	if err != nil {
+		return err
+	}
+	if locked > 0 {
+		return &RetryAfterError{Err: ErrAccountLocked, RetryAfter: locked}
+	}
+
+	byIP, err := g.byIP.Allow(ctx, ip)
+	if err != nil {
+		return err
+	}
+	if !byIP.Allowed {
+		return &RetryAfterError{Err: ErrTooManyAttempts, RetryAfter: byIP.RetryAfter}
+	}
+
+	byEmail, err := g.byEmail.Allow(ctx, email)
+	if err != nil {
+		return err
+	}
+	if !byEmail.Allowed {
+		return &RetryAfterError{Err: ErrTooManyAttempts, RetryAfter: byEmail.RetryAfter}
+	}
+	return nil
+}
+
+// RecordFailure учитывает неверный пароль; возвращает длительность блокировки, если она началась
+func (g *LoginGuard) RecordFailure(ctx context.Context, email string) (time.Duration, error) {
+	email = normalizeLoginEmail(email)
+	keys := []string{loginFailuresPrefix + email, loginLockLevelPrefix + email, loginLockedPrefix + email}
+	ms, err := recordFailureScript.Run(ctx, g.redis, keys,
+		lockoutWindow.Milliseconds(), lockoutThreshold, lockoutBase.Milliseconds(),
+		lockoutMax.Milliseconds(), lockoutLevelTTL.Milliseconds(), uuid.NewString()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// RecordSuccess сбрасывает счётчик неудач и длительность блокировок
+func (g *LoginGuard) RecordSuccess(ctx context.Context, email string) error {
+	email = normalizeLoginEmail(email)
+	return g.redis.Del(ctx, loginFailuresPrefix+email, loginLockLevelPrefix+email).Err()
+}
+
+// Unlock снимает блокировку и ограничение частоты для email — вызывается администратором
+func (g *LoginGuard) Unlock(ctx context.Context, email string) error {
+	email = normalizeLoginEmail(email)
+	if err := g.redis.Del(ctx, loginFailuresPrefix+email, loginLockLevelPrefix+email, loginLockedPrefix+email).Err(); err != nil {
+		return err
+	}
+	return g.byEmail.Reset(ctx, email)
+}
+
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/company-superapp/internal/domain"
+	"github.com/yourname/company-superapp/internal/pkg/metrics"
+)
+
+const (
+	// pushPendingPrefix — HASH накопленных за окно сообщений чата для пользователя
+	pushPendingPrefix = "push_pending:"
+	// pushLockPrefix — признак того, что отправка накопленного уже запланирована
+	pushLockPrefix = "push_lock:"
+	// pushCoalesceWindow — сообщения чата, пришедшие за это время, объединяются в одно уведомление
+	pushCoalesceWindow = 10 * time.Second
+	// pushPreviewLength — длина текста сообщения в push-уведомлении, в символах
+	pushPreviewLength = 100
+	pushTimeout       = 10 * time.Second
+)
+
+// ChatConnectionChecker сообщает, получит ли пользователь событие чата через открытое WebSocket-соединение
+type ChatConnectionChecker interface {
+	IsConnectedToChat(ctx context.Context, userID, chatID uuid.UUID) bool
+}
+
+// MessagePushService отправляет push о новых сообщениях участникам без открытого соединения с чатом.
+// Упоминания уведомляют сразу и даже в заглушённых чатах; остальные сообщения учитывают
+// отключение уведомлений и объединяются: серия сообщений за pushCoalesceWindow даёт один push.
+type MessagePushService struct {
+	chatRepo            domain.ChatRepository
+	userRepo            domain.UserRepository
+	notificationService *NotificationService
+	redis               *redis.Client
+	connections         ChatConnectionChecker
+}
+
+func NewMessagePushService(chatRepo domain.ChatRepository, userRepo domain.UserRepository, notificationService *NotificationService, redisClient *redis.Client) *MessagePushService {
+	return &MessagePushService{
+		chatRepo:            chatRepo,
+		userRepo:            userRepo,
+		notificationService: notificationService,
+		redis:               redisClient,
+	}
+}
+
+// SetConnectionChecker подключает WebSocket Hub: он создаётся после сервисов, поэтому не передаётся в конструктор.
+// Вызывается при старте, до обработки запросов.
+func (s *MessagePushService) SetConnectionChecker(checker ChatConnectionChecker) {
+	s.connections = checker
+}
+
+// NotifyNewMessage рассылает уведомления о сохранённом сообщении в фоне
+func (s *MessagePushService) NotifyNewMessage(msg *domain.Message) {
+	go s.notify(msg)
+}
+
+func (s *MessagePushService) notify(msg *domain.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+	defer cancel()
+
+	chat, err := s.chatRepo.GetByID(ctx, msg.ChatID)
+	if err != nil || chat == nil {
+		log.Printf("error loading chat %s for push: %v", msg.ChatID, err)
+		return
+	}
+	senderName := "New message"
+	if sender, err := s.userRepo.FindByID(ctx, msg.SenderID); err == nil && sender != nil {
+		senderName = displayName(sender)
+	}
+
+	title, body := senderName, messagePreview(msg)
+	if chat.Type == domain.ChatTypeGroup && chat.Name != nil {
+		title, body = *chat.Name, senderName+": "+body
+	}
+	data := map[string]string{
+		"type":       "message",
+		"chat_id":    msg.ChatID.String(),
+		"message_id": strconv.FormatInt(msg.ID, 10),
+	}
+
+	mentioned := make(map[uuid.UUID]bool, len(msg.Mentions))
+	for _, userID := range msg.Mentions {
+		mentioned[userID] = true
+		if s.isConnected(ctx, userID, msg.ChatID) {
+			continue
+		}
+		mentionData := map[string]string{"type": "mention", "chat_id": data["chat_id"], "message_id": data["message_id"]}
+		if err := s.notificationService.SendToUser(ctx, userID, senderName+" mentioned you", messagePreview(msg), mentionData); err != nil {
+			log.Printf("error sending mention push to user %s: %v", userID, err)
+			continue
+		}
+		metrics.PushNotificationsTotal.WithLabelValues("mention").Inc()
+	}
+
+	recipients, err := s.chatRepo.GetUnmutedMemberIDs(ctx, msg.ChatID)
+	if err != nil {
+		log.Printf("error loading push recipients for chat %s: %v", msg.ChatID, err)
+		return
+	}
+	for _, userID := range recipients {
+		if userID == msg.SenderID || mentioned[userID] || s.isConnected(ctx, userID, msg.ChatID) {
+			continue
+		}
+		if err := s.enqueue(ctx, userID, msg.ChatID, title, body, data); err != nil {
+			log.Printf("error queueing push for user %s: %v", userID, err)
+		}
+	}
+}
+
+// enqueue добавляет сообщение в окно объединения; первое сообщение окна планирует отправку
+func (s *MessagePushService) enqueue(ctx context.Context, userID, chatID uuid.UUID, title, body string, data map[string]string) error {
+	suffix := userID.String() + ":" + chatID.String()
+
+	pipe := s.redis.TxPipeline()
+	pipe.HIncrBy(ctx, pushPendingPrefix+suffix, "count", 1)
+	pipe.HSet(ctx, pushPendingPrefix+suffix, "title", title, "body", body, "message_id", data["message_id"])
+	pipe.Expire(ctx, pushPendingPrefix+suffix, 3*pushCoalesceWindow)
+	scheduled := pipe.SetNX(ctx, pushLockPrefix+suffix, 1, 2*pushCoalesceWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	// Отправку планирует инстанс, первым взявший блокировку; если он упадёт, окно истечёт по TTL
+	if scheduled.Val() {
+		time.AfterFunc(pushCoalesceWindow, func() { s.flush(userID, chatID) })
+	}
+	return nil
+}
+
+// flush отправляет одно уведомление за все сообщения окна
+func (s *MessagePushService) flush(userID, chatID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+	defer cancel()
+
+	suffix := userID.String() + ":" + chatID.String()
+	pipe := s.redis.TxPipeline()
+	pending := pipe.HGetAll(ctx, pushPendingPrefix+suffix)
+	pipe.Del(ctx, pushPendingPrefix+suffix, pushLockPrefix+suffix)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("error flushing push for user %s: %v", userID, err)
+		return
+	}
+
+	fields := pending.Val()
+	if len(fields) == 0 {
+		return
+	}
+	// Пользователь успел подключиться и уже получил сообщения
+	if s.isConnected(ctx, userID, chatID) {
+		return
+	}
+
+	body := fields["body"]
+	if count, _ := strconv.Atoi(fields["count"]); count > 1 {
+		body = fmt.Sprintf("%d new messages. %s", count, body)
+	}
+	data := map[string]string{
+		"type":       "message",
+		"chat_id":    chatID.String(),
+		"message_id": fields["message_id"],
+		"count":      fields["count"],
+	}
+	if err := s.notificationService.SendToUser(ctx, userID, fields["title"], body, data); err != nil {
+		log.Printf("error sending message push to user %s: %v", userID, err)
+		return
+	}
+	metrics.PushNotificationsTotal.WithLabelValues("message").Inc()
+}
+
+func (s *MessagePushService) isConnected(ctx context.Context, userID, chatID uuid.UUID) bool {
+	return s.connections != nil && s.connections.IsConnectedToChat(ctx, userID, chatID)
+}
+
+func displayName(user *domain.User) string {
+	if user.FullName != "" {
+		return user.FullName
+	}
+	return user.Email
+}
+
+// messagePreview — текст сообщения для уведомления, обрезанный до pushPreviewLength символов
+func messagePreview(msg *domain.Message) string {
+	if msg.Content == "" && len(msg.Attachments) > 0 {
+		return "Attachment"
+	}
+	runes := []rune(msg.Content)
+	if len(runes) <= pushPreviewLength {
+		return msg.Content
+	}
+	return string(runes[:pushPreviewLength]) + "…"
+}
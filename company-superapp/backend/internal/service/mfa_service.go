@@ -0,0 +1,356 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/company-superapp/internal/domain"
+	"github.com/yourname/company-superapp/internal/pkg/encryption"
+	"github.com/yourname/company-superapp/internal/pkg/totp"
+)
+
+var (
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotSetUp       = errors.New("two-factor authentication setup has not been started")
+	ErrInvalidMFACode    = errors.New("invalid two-factor authentication code")
+	ErrMFARequiredByRole = errors.New("two-factor authentication is required for your role")
+	ErrMFALocked         = errors.New("too many invalid two-factor authentication codes, try again later")
+)
+
+const (
+	// recoveryCodeCount — сколько кодов восстановления выдаётся за раз
+	recoveryCodeCount = 10
+
+	// Неверные коды блокируют проверку кодов пользователя так же, как неверные пароли — вход
+	// (см. LoginGuard): иначе украденный access token позволил бы перебрать TOTP и выключить MFA
+	mfaFailuresPrefix  = "mfa_failures:"
+	mfaLockLevelPrefix = "mfa_lock_level:"
+	mfaLockedPrefix    = "mfa_locked:"
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFAService управляет вторым фактором (TOTP) и кодами восстановления
+type MFAService struct {
+	mfaRepo           domain.MFARepository
+	userRepo          domain.UserRepository
+	encryptionService *encryption.EncryptionService
+	redis             *redis.Client
+	issuer            string
+	requiredRoles     map[string]bool
+}
+
+func NewMFAService(mfaRepo domain.MFARepository, userRepo domain.UserRepository, encryptionService *encryption.EncryptionService, redisClient *redis.Client, issuer string, requiredRoles []string) *MFAService {
+	roles := make(map[string]bool, len(requiredRoles))
+	for _, role := range requiredRoles {
+		roles[role] = true
+	}
+	return &MFAService{
+		mfaRepo:           mfaRepo,
+		userRepo:          userRepo,
+		encryptionService: encryptionService,
+		redis:             redisClient,
+		issuer:            issuer,
+		requiredRoles:     roles,
+	}
+}
+
+// MFASetup — данные для добавления аккаунта в приложение-аутентификатор
+type MFASetup struct {
+	// Secret — секрет в base32 для ручного ввода
+	Secret string `json:"secret"`
+	// ProvisioningURI — otpauth:// URI, клиент показывает его как QR-код
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type MFAStatus struct {
+	Enabled bool `json:"enabled"`
+	// Required — роль пользователя не позволяет выключить MFA
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+type MFACodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Required сообщает, обязателен ли второй фактор для роли
+func (s *MFAService) Required(role string) bool {
+	return s.requiredRoles[role]
+}
+
+func (s *MFAService) IsEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	mfa, err := s.mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return mfa != nil && mfa.EnabledAt != nil, nil
+}
+
+func (s *MFAService) Status(ctx context.Context, userID uuid.UUID, role string) (*MFAStatus, error) {
+	enabled, err := s.IsEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &MFAStatus{Enabled: enabled, Required: s.Required(role)}
+	if enabled {
+		if status.RecoveryCodesLeft, err = s.mfaRepo.CountRecoveryCodes(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// Setup выпускает новый секрет. MFA включается только после подтверждения кодом (Enable),
+// поэтому ошибка при сканировании QR-кода не блокирует вход
+func (s *MFAService) Setup(ctx context.Context, userID uuid.UUID) (*MFASetup, error) {
+	enabled, err := s.IsEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.encryptionService.Encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.SavePending(ctx, userID, encrypted); err != nil {
+		return nil, err
+	}
+
+	return &MFASetup{
+		Secret:          totp.EncodeSecret(secret),
+		ProvisioningURI: totp.ProvisioningURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// Enable подтверждает настройку первым кодом и возвращает коды восстановления.
+// Они показываются пользователю один раз, в базе хранятся только их хеши
+func (s *MFAService) Enable(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	mfa, err := s.mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil {
+		return nil, ErrMFANotSetUp
+	}
+	if mfa.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if err := s.checkLocked(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	step, ok, err := s.validateTOTP(mfa, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, s.recordFailure(ctx, userID)
+	}
+	if err := s.recordSuccess(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.Enable(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify проверяет TOTP-код или код восстановления; каждый из них принимается один раз.
+// После серии неверных кодов проверка блокируется, см. recordFailure
+func (s *MFAService) Verify(ctx context.Context, userID uuid.UUID, code string) error {
+	mfa, err := s.mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if mfa == nil || mfa.EnabledAt == nil {
+		return ErrMFANotEnabled
+	}
+	if err := s.checkLocked(ctx, userID); err != nil {
+		return err
+	}
+
+	err = s.verifyCode(ctx, userID, mfa, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		return s.recordFailure(ctx, userID)
+	}
+	if err != nil {
+		return err
+	}
+	return s.recordSuccess(ctx, userID)
+}
+
+// verifyCode проверяет код без учёта блокировки; неверный код — ErrInvalidMFACode
+func (s *MFAService) verifyCode(ctx context.Context, userID uuid.UUID, mfa *domain.UserMFA, code string) error {
+	code = normalizeMFACode(code)
+	if len(code) == totp.Digits && isDigits(code) {
+		step, ok, err := s.validateTOTP(mfa, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		used, err := s.mfaRepo.UseStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	used, err := s.mfaRepo.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// Disable выключает MFA после проверки кода; для ролей из политики это запрещено
+func (s *MFAService) Disable(ctx context.Context, userID uuid.UUID, code string) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	if s.Required(user.Role) {
+		return ErrMFARequiredByRole
+	}
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+	return s.mfaRepo.Delete(ctx, userID)
+}
+
+// RegenerateRecoveryCodes заменяет все коды восстановления новыми
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// checkLocked вызывается до проверки кода: во время блокировки не принимается даже верный код
+func (s *MFAService) checkLocked(ctx context.Context, userID uuid.UUID) error {
+	locked, err := s.redis.PTTL(ctx, mfaLockedPrefix+userID.String()).Result()
+	if err != nil {
+		return err
+	}
+	if locked > 0 {
+		return &RetryAfterError{Err: ErrMFALocked, RetryAfter: locked}
+	}
+	return nil
+}
+
+// recordFailure учитывает неверный код с теми же порогами, что и неверные пароли.
+// Возвращает ErrInvalidMFACode или, если началась блокировка, RetryAfterError
+func (s *MFAService) recordFailure(ctx context.Context, userID uuid.UUID) error {
+	id := userID.String()
+	keys := []string{mfaFailuresPrefix + id, mfaLockLevelPrefix + id, mfaLockedPrefix + id}
+	ms, err := recordFailureScript.Run(ctx, s.redis, keys,
+		lockoutWindow.Milliseconds(), lockoutThreshold, lockoutBase.Milliseconds(),
+		lockoutMax.Milliseconds(), lockoutLevelTTL.Milliseconds(), uuid.NewString()).Int64()
+	if err != nil {
+		return err
+	}
+	if ms > 0 {
+		return &RetryAfterError{Err: ErrMFALocked, RetryAfter: time.Duration(ms) * time.Millisecond}
+	}
+	return ErrInvalidMFACode
+}
+
+// recordSuccess сбрасывает счётчик неверных кодов и длительность блокировок
+func (s *MFAService) recordSuccess(ctx context.Context, userID uuid.UUID) error {
+	id := userID.String()
+	return s.redis.Del(ctx, mfaFailuresPrefix+id, mfaLockLevelPrefix+id).Err()
+}
+
+func (s *MFAService) validateTOTP(mfa *domain.UserMFA, code string) (int64, bool, error) {
+	secret, err := s.encryptionService.Decrypt(mfa.TOTPSecretEncrypted)
+	if err != nil {
+		return 0, false, err
+	}
+	step, ok := totp.Validate(secret, normalizeMFACode(code), time.Now())
+	// Шаг не старше последнего принятого — повтор уже использованного кода
+	if ok && step <= mfa.LastUsedStep {
+		return 0, false, nil
+	}
+	return step, ok, nil
+}
+
+// newRecoveryCodes возвращает коды вида xxxxx-xxxxx и их хеши для хранения
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 6)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		encoded := strings.ToLower(recoveryCodeEncoding.EncodeToString(raw))[:10]
+		codes[i] = encoded[:5] + "-" + encoded[5:]
+		hashes[i] = hashRecoveryCode(encoded)
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeMFACode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeMFACode убирает пробелы и дефисы, которые пользователи вводят вместе с кодом
+func normalizeMFACode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
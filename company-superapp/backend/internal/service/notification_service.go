@@ -27,12 +27,14 @@ type RegisterTokenRequest struct {
 	DeviceInfo *string `json:"device_info,omitempty"`
 }
 
-func (s *NotificationService) RegisterToken(ctx context.Context, userID uuid.UUID, req RegisterTokenRequest) error {
+// RegisterToken сохраняет push-токен устройства; sessionID — сессия входа, при её отзыве токен удаляется
+func (s *NotificationService) RegisterToken(ctx context.Context, userID uuid.UUID, sessionID *uuid.UUID, req RegisterTokenRequest) error {
 	pushToken := &domain.PushToken{
 		ID:         uuid.New(),
 		UserID:     userID,
 		Token:      req.Token,
 		DeviceInfo: req.DeviceInfo,
+		SessionID:  sessionID,
 	}
 
 	return s.pushTokenRepo.Create(ctx, pushToken)
@@ -43,6 +45,11 @@ func (s *NotificationService) UnregisterToken(ctx context.Context, token string)
 }
 
 func (s *NotificationService) SendToUser(ctx context.Context, userID uuid.UUID, title string, body string, data map[string]string) error {
+	// FCM не настроен: push-уведомления отключены
+	if s.fcmClient == nil {
+		return nil
+	}
+
 	tokens, err := s.pushTokenRepo.GetByUserID(ctx, userID)
 	if err != nil {
 		return err
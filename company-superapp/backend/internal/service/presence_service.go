@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// presenceKeyPrefix — ZSET живых соединений пользователя со всех инстансов:
+	// member — ID соединения, score — unix-время, до которого соединение считается живым
+	presenceKeyPrefix = "presence:"
+	// lastSeenKeyPrefix — время, когда у пользователя закрылось последнее соединение
+	lastSeenKeyPrefix = "last_seen:"
+	// PresenceTTL — соединение без heartbeat дольше этого срока считается оборванным
+	// (например, если инстанс API упал, не успев удалить его)
+	PresenceTTL      = 90 * time.Second
+	lastSeenTTL      = 30 * 24 * time.Hour
+	maxPresenceUsers = 200
+)
+
+var (
+	ErrNoPresenceUsers      = errors.New("at least one user id is required")
+	ErrTooManyPresenceUsers = errors.New("too many user ids")
+)
+
+// Presence — статус пользователя в сети
+type Presence struct {
+	UserID   uuid.UUID  `json:"user_id"`
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// PresenceService отслеживает WebSocket-соединения пользователей на всех инстансах API через Redis
+type PresenceService struct {
+	redis *redis.Client
+}
+
+func NewPresenceService(redisClient *redis.Client) *PresenceService {
+	return &PresenceService{redis: redisClient}
+}
+
+// Connect регистрирует соединение; online = true, если до этого у пользователя не было живых соединений
+func (s *PresenceService) Connect(ctx context.Context, userID uuid.UUID, connID string) (bool, error) {
+	key := presenceKeyPrefix + userID.String()
+	now := time.Now()
+
+	pipe := s.redis.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Unix(), 10))
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Add(PresenceTTL).Unix()), Member: connID})
+	pipe.Expire(ctx, key, PresenceTTL)
+	count := pipe.ZCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return count.Val() == 1, nil
+}
+
+// Heartbeat продлевает жизнь соединения ещё на PresenceTTL
+func (s *PresenceService) Heartbeat(ctx context.Context, userID uuid.UUID, connID string) error {
+	key := presenceKeyPrefix + userID.String()
+
+	pipe := s.redis.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(time.Now().Add(PresenceTTL).Unix()), Member: connID})
+	pipe.Expire(ctx, key, PresenceTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Disconnect удаляет соединение; offline = true, если это было последнее живое соединение пользователя
+func (s *PresenceService) Disconnect(ctx context.Context, userID uuid.UUID, connID string) (bool, error) {
+	key := presenceKeyPrefix + userID.String()
+	now := time.Now()
+
+	pipe := s.redis.TxPipeline()
+	pipe.ZRem(ctx, key, connID)
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Unix(), 10))
+	count := pipe.ZCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	if count.Val() > 0 {
+		return false, nil
+	}
+
+	if err := s.redis.Set(ctx, lastSeenKeyPrefix+userID.String(), now.Unix(), lastSeenTTL).Err(); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// IsOnline проверяет, есть ли у пользователя живое соединение на каком-либо инстансе
+func (s *PresenceService) IsOnline(ctx context.Context, userID uuid.UUID) (bool, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	count, err := s.redis.ZCount(ctx, presenceKeyPrefix+userID.String(), "("+now, "+inf").Result()
+	return count > 0, err
+}
+
+// GetPresence возвращает статусы пользователей в порядке userIDs
+func (s *PresenceService) GetPresence(ctx context.Context, userIDs []uuid.UUID) ([]Presence, error) {
+	if len(userIDs) == 0 {
+		return nil, ErrNoPresenceUsers
+	}
+	if len(userIDs) > maxPresenceUsers {
+		return nil, ErrTooManyPresenceUsers
+	}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	pipe := s.redis.Pipeline()
+	counts := make([]*redis.IntCmd, len(userIDs))
+	lastSeen := make([]*redis.StringCmd, len(userIDs))
+	for i, userID := range userIDs {
+		counts[i] = pipe.ZCount(ctx, presenceKeyPrefix+userID.String(), "("+now, "+inf")
+		lastSeen[i] = pipe.Get(ctx, lastSeenKeyPrefix+userID.String())
+	}
+	// redis.Nil для пользователей без last_seen — не ошибка
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	result := make([]Presence, len(userIDs))
+	for i, userID := range userIDs {
+		result[i] = Presence{UserID: userID, Online: counts[i].Val() > 0}
+		if result[i].Online {
+			continue
+		}
+		if ts, err := lastSeen[i].Int64(); err == nil {
+			seen := time.Unix(ts, 0).UTC()
+			result[i].LastSeen = &seen
+		}
+	}
+	return result, nil
+}
@@ -3,10 +3,12 @@ package service
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/yourname/company-superapp/internal/domain"
+	"github.com/yourname/company-superapp/internal/pkg/metrics"
 )
 
 var (
@@ -16,12 +18,14 @@ var (
 type TaskService struct {
 	taskRepo    domain.TaskRepository
 	messageRepo domain.MessageRepository
+	chatRepo    domain.ChatRepository
 }
 
-func NewTaskService(taskRepo domain.TaskRepository, messageRepo domain.MessageRepository) *TaskService {
+func NewTaskService(taskRepo domain.TaskRepository, messageRepo domain.MessageRepository, chatRepo domain.ChatRepository) *TaskService {
 	return &TaskService{
 		taskRepo:    taskRepo,
 		messageRepo: messageRepo,
+		chatRepo:    chatRepo,
 	}
 }
 
@@ -46,6 +50,7 @@ func (s *TaskService) Create(ctx context.Context, creatorID uuid.UUID, input Cre
 	if err != nil {
 		return nil, err
 	}
+	metrics.TasksCreatedTotal.Inc()
 
 	return task, nil
 }
@@ -54,44 +59,70 @@ type CreateFromMessageInput struct {
 	MessageID  int64      `json:"message_id" binding:"required"`
 	AssigneeID *uuid.UUID `json:"assignee_id"`
 	DueDate    *time.Time `json:"due_date"`
+	// Thread — связать задачу со всем тредом сообщения, а не только с ним самим
+	Thread bool `json:"thread"`
 }
 
+// CreateFromMessage создаёт задачу из сообщения чата; создатель должен быть участником этого чата
 func (s *TaskService) CreateFromMessage(ctx context.Context, creatorID uuid.UUID, input CreateFromMessageInput) (*domain.Task, error) {
-	messages, err := s.messageRepo.GetMessagesByChatID(ctx, uuid.Nil, 1, 0)
+	msg, err := s.getMessage(ctx, input.MessageID)
 	if err != nil {
 		return nil, err
 	}
-
-	var messageContent string
-	for _, msg := range messages {
-		if msg.ID == input.MessageID {
-			messageContent = msg.Content
-			break
-		}
+	isMember, err := s.chatRepo.IsMember(ctx, msg.ChatID, creatorID)
+	if err != nil {
+		return nil, err
 	}
-
-	if messageContent == "" {
-		messageContent = "Task from message"
+	if !isMember {
+		return nil, ErrNotChatMember
 	}
 
 	task := &domain.Task{
-		Title:           messageContent,
+		Title:           msg.Content,
 		Description:     "Created from chat message",
 		Status:          domain.TaskStatusTodo,
 		CreatorID:       creatorID,
 		AssigneeID:      input.AssigneeID,
 		DueDate:         input.DueDate,
-		SourceMessageID: &input.MessageID,
+		SourceMessageID: &msg.ID,
+	}
+
+	if input.Thread {
+		root := msg
+		if msg.ThreadRootID != nil {
+			if root, err = s.getMessage(ctx, *msg.ThreadRootID); err != nil {
+				return nil, err
+			}
+		}
+		task.Title = root.Content
+		task.Description = "Created from chat thread"
+		task.SourceThreadID = &root.ID
+	}
+
+	if strings.TrimSpace(task.Title) == "" {
+		task.Title = "Task from message"
 	}
 
 	err = s.taskRepo.Create(ctx, task)
 	if err != nil {
 		return nil, err
 	}
+	metrics.TasksCreatedTotal.Inc()
 
 	return task, nil
 }
 
+func (s *TaskService) getMessage(ctx context.Context, id int64) (*domain.Message, error) {
+	msg, err := s.messageRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, ErrMessageNotFound
+	}
+	return msg, nil
+}
+
 func (s *TaskService) GetAll(ctx context.Context, assigneeID *uuid.UUID, status *domain.TaskStatus) ([]domain.Task, error) {
 	return s.taskRepo.GetAll(ctx, assigneeID, status)
 }
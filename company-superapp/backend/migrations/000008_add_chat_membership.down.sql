@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS messenger.idx_chat_members_user_id;
+
+ALTER TABLE messenger.chat_members DROP COLUMN IF EXISTS joined_at;
+ALTER TABLE messenger.chat_members DROP COLUMN IF EXISTS role;
+
+ALTER TABLE messenger.chats DROP COLUMN IF EXISTS private_key;
+ALTER TABLE messenger.chats DROP COLUMN IF EXISTS created_by;
+ALTER TABLE messenger.chats DROP COLUMN IF EXISTS name;
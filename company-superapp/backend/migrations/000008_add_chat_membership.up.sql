@@ -0,0 +1,13 @@
+-- Название группового чата и его создатель
+ALTER TABLE messenger.chats ADD COLUMN IF NOT EXISTS name TEXT;
+ALTER TABLE messenger.chats ADD COLUMN IF NOT EXISTS created_by UUID REFERENCES system.users(id) ON DELETE SET NULL;
+
+-- Ключ пары участников личного чата: защищает от дубликатов при одновременном создании
+ALTER TABLE messenger.chats ADD COLUMN IF NOT EXISTS private_key TEXT UNIQUE;
+
+-- Роль участника и время вступления
+ALTER TABLE messenger.chat_members ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'member'));
+ALTER TABLE messenger.chat_members ADD COLUMN IF NOT EXISTS joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS idx_chat_members_user_id ON messenger.chat_members(user_id);
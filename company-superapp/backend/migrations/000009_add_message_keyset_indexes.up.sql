@@ -0,0 +1,2 @@
+-- Keyset-пагинация истории чата по messages.id
+CREATE INDEX IF NOT EXISTS idx_messages_chat_id_id ON messenger.messages(chat_id, id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS messenger.message_edits;
+
+ALTER TABLE messenger.messages DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE messenger.messages DROP COLUMN IF EXISTS edited_at;
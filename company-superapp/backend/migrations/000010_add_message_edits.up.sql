@@ -0,0 +1,15 @@
+-- Редактирование и мягкое удаление сообщений
+ALTER TABLE messenger.messages ADD COLUMN IF NOT EXISTS edited_at TIMESTAMPTZ;
+ALTER TABLE messenger.messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Предыдущие версии отредактированных сообщений
+CREATE TABLE IF NOT EXISTS messenger.message_edits (
+    id BIGSERIAL PRIMARY KEY,
+    message_id BIGINT NOT NULL REFERENCES messenger.messages(id) ON DELETE CASCADE,
+    previous_content TEXT NOT NULL,
+    edited_by UUID REFERENCES system.users(id) ON DELETE SET NULL,
+    edited_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS idx_message_edits_message_id ON messenger.message_edits(message_id);
@@ -0,0 +1 @@
+ALTER TABLE messenger.chat_members DROP COLUMN IF EXISTS last_read_message_id;
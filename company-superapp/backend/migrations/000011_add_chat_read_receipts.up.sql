@@ -0,0 +1,6 @@
+-- Последнее прочитанное участником сообщение: из него считаются непрочитанные
+ALTER TABLE messenger.chat_members ADD COLUMN IF NOT EXISTS last_read_message_id BIGINT NOT NULL DEFAULT 0;
+
+-- Существующая переписка считается прочитанной, иначе после миграции вся история стала бы непрочитанной
+UPDATE messenger.chat_members cm
+SET last_read_message_id = COALESCE((SELECT MAX(id) FROM messenger.messages m WHERE m.chat_id = cm.chat_id), 0);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS messenger.idx_messages_thread_root_id;
+
+ALTER TABLE tasks.tasks DROP COLUMN IF EXISTS source_thread_id;
+
+ALTER TABLE messenger.messages DROP COLUMN IF EXISTS thread_root_id;
+ALTER TABLE messenger.messages DROP COLUMN IF EXISTS reply_to_id;
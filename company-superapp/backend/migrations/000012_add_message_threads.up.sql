@@ -0,0 +1,9 @@
+-- Ответы и треды: reply_to_id — сообщение, на которое ответили, thread_root_id — корень треда
+ALTER TABLE messenger.messages ADD COLUMN IF NOT EXISTS reply_to_id BIGINT REFERENCES messenger.messages(id) ON DELETE SET NULL;
+ALTER TABLE messenger.messages ADD COLUMN IF NOT EXISTS thread_root_id BIGINT REFERENCES messenger.messages(id) ON DELETE SET NULL;
+
+-- Задача может ссылаться на тред целиком
+ALTER TABLE tasks.tasks ADD COLUMN IF NOT EXISTS source_thread_id BIGINT REFERENCES messenger.messages(id) ON DELETE SET NULL;
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS idx_messages_thread_root_id ON messenger.messages(thread_root_id, id) WHERE thread_root_id IS NOT NULL;
@@ -0,0 +1,8 @@
+-- Реакции на сообщения: одна строка на пользователя и эмодзи
+CREATE TABLE IF NOT EXISTS messenger.message_reactions (
+    message_id BIGINT NOT NULL REFERENCES messenger.messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES system.users(id) ON DELETE CASCADE,
+    emoji TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id, emoji)
+);
@@ -0,0 +1,17 @@
+-- Вложения чата: файл загружается в MinIO по presigned URL, затем привязывается к сообщению
+CREATE TABLE IF NOT EXISTS messenger.attachments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    chat_id UUID NOT NULL REFERENCES messenger.chats(id) ON DELETE CASCADE,
+    message_id BIGINT REFERENCES messenger.messages(id) ON DELETE CASCADE,
+    uploader_id UUID NOT NULL REFERENCES system.users(id) ON DELETE CASCADE,
+    object_key TEXT NOT NULL UNIQUE,
+    file_name TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'uploaded')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS idx_attachments_message_id ON messenger.attachments(message_id) WHERE message_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_attachments_chat_id ON messenger.attachments(chat_id);
@@ -0,0 +1,11 @@
+-- Упоминания пользователей в сообщениях (@email или @<user id>)
+CREATE TABLE IF NOT EXISTS messenger.mentions (
+    message_id BIGINT NOT NULL REFERENCES messenger.messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES system.users(id) ON DELETE CASCADE,
+    chat_id UUID NOT NULL REFERENCES messenger.chats(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id)
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS idx_mentions_user_id_message_id ON messenger.mentions(user_id, message_id DESC);
@@ -0,0 +1,2 @@
+ALTER TABLE messenger.chat_members DROP COLUMN IF EXISTS muted_until;
+ALTER TABLE messenger.chat_members DROP COLUMN IF EXISTS muted;
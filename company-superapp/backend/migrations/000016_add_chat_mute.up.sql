@@ -0,0 +1,3 @@
+-- Отключение уведомлений чата: muted_until пуст — до ручного включения
+ALTER TABLE messenger.chat_members ADD COLUMN IF NOT EXISTS muted BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE messenger.chat_members ADD COLUMN IF NOT EXISTS muted_until TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS messenger.idx_messages_sender_client_msg_id;
+ALTER TABLE messenger.messages DROP COLUMN IF EXISTS client_msg_id;
@@ -0,0 +1,5 @@
+-- Идентификатор, который клиент генерирует для сообщения: повторная отправка не создаёт дубль
+ALTER TABLE messenger.messages ADD COLUMN IF NOT EXISTS client_msg_id VARCHAR(64);
+
+-- Indexes
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_sender_client_msg_id ON messenger.messages(sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS system.idx_push_tokens_session_id;
+ALTER TABLE system.push_tokens DROP COLUMN IF EXISTS session_id;
@@ -0,0 +1,5 @@
+-- Сессия (семейство refresh token), в которой устройство зарегистрировало push-токен: при её отзыве токен удаляется
+ALTER TABLE system.push_tokens ADD COLUMN IF NOT EXISTS session_id UUID;
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS idx_push_tokens_session_id ON system.push_tokens(session_id) WHERE session_id IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE system.users DROP COLUMN IF EXISTS email_verified_at;
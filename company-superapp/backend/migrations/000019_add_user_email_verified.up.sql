@@ -0,0 +1,5 @@
+-- Время подтверждения email: до подтверждения вход запрещён
+ALTER TABLE system.users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+-- Пользователи, зарегистрированные до появления подтверждения, считаются подтверждёнными
+UPDATE system.users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
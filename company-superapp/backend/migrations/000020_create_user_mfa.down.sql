@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS system.mfa_recovery_codes;
+DROP TABLE IF EXISTS system.user_mfa;
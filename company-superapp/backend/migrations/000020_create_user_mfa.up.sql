@@ -0,0 +1,20 @@
+-- TOTP-секрет пользователя, зашифрованный AES-256-GCM. enabled_at пуст, пока настройка не подтверждена кодом
+CREATE TABLE IF NOT EXISTS system.user_mfa (
+    user_id UUID PRIMARY KEY REFERENCES system.users(id) ON DELETE CASCADE,
+    totp_secret_encrypted BYTEA NOT NULL,
+    enabled_at TIMESTAMPTZ,
+    -- Последний принятый шаг TOTP: код нельзя предъявить повторно
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Одноразовые коды восстановления (SHA-256)
+CREATE TABLE IF NOT EXISTS system.mfa_recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES system.users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON system.mfa_recovery_codes(user_id);
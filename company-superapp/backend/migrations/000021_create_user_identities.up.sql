@@ -0,0 +1,15 @@
+-- Аккаунты пользователей во внешних IdP (OpenID Connect). Пара issuer + subject однозначно определяет аккаунт
+CREATE TABLE IF NOT EXISTS system.user_identities (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES system.users(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    -- email из последнего id_token
+    email TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (issuer, subject)
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON system.user_identities(user_id);